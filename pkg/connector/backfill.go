@@ -0,0 +1,97 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/duo/matrix-pylon/pkg/ids"
+	"github.com/duo/matrix-pylon/pkg/onebot"
+
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+)
+
+func (pc *PylonClient) FetchMessages(ctx context.Context, params bridgev2.FetchMessagesParams) (*bridgev2.FetchMessagesResponse, error) {
+	if !pc.IsLoggedIn() {
+		return nil, bridgev2.ErrNotLoggedIn
+	}
+
+	var messageSeq string
+	if !params.Forward {
+		if params.Cursor != "" {
+			messageSeq = string(params.Cursor)
+		} else if params.AnchorMessage != nil {
+			if _, msgID, err := ids.ParseMessageID(params.AnchorMessage.ID); err == nil {
+				messageSeq = msgID
+			}
+		}
+	}
+
+	peerType, peerID := ids.ParsePortalID(params.Portal.ID)
+
+	var history []*onebot.Message
+	var err error
+	switch peerType {
+	case ids.PeerTypeUser:
+		history, err = pc.client.GetFriendMsgHistory(peerID, messageSeq, params.Count)
+	case ids.PeerTypeGroup:
+		history, err = pc.client.GetGroupMsgHistory(peerID, messageSeq, params.Count)
+	default:
+		return nil, fmt.Errorf("unsupported chat type %s", peerType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch history of %s: %w", peerID, err)
+	}
+
+	slices.SortStableFunc(history, func(a, b *onebot.Message) int {
+		return int(a.Time - b.Time)
+	})
+
+	// The history API can't page forward, it returns the latest page: only keep what is newer than the anchor
+	var after time.Time
+	if params.Forward && params.AnchorMessage != nil {
+		after = params.AnchorMessage.Timestamp
+	}
+
+	messages := make([]*bridgev2.BackfillMessage, 0, len(history))
+	for _, msg := range history {
+		// The anchor message is included in the page
+		if msg.MessageID == messageSeq {
+			continue
+		}
+		if segs, ok := msg.Message.([]onebot.ISegment); !ok || len(segs) == 0 {
+			continue
+		}
+		if !after.IsZero() && !time.UnixMilli(msg.Time*1000).After(after) {
+			continue
+		}
+
+		// History doesn't mark messages sent by self, fix them up for reply and peer lookups
+		if peerType == ids.PeerTypeUser && msg.Sender.UserID == string(pc.userLogin.ID) {
+			msg.PostType = "message_sent"
+			msg.TargetID = peerID
+		}
+
+		sender := pc.makeEventSender(msg.Sender.UserID)
+		intent := params.Portal.GetIntentFor(ctx, sender, pc.userLogin, bridgev2.RemoteEventMessage)
+		messages = append(messages, &bridgev2.BackfillMessage{
+			ConvertedMessage: pc.main.MsgConv.OnebotToMatrix(ctx, pc.client, params.Portal, intent, msg),
+			Sender:           sender,
+			ID:               ids.MakeMessageID(peerID, msg.MessageID),
+			Timestamp:        time.UnixMilli(msg.Time * 1000),
+		})
+	}
+
+	resp := &bridgev2.FetchMessagesResponse{
+		Messages: messages,
+		Forward:  params.Forward,
+		HasMore:  !params.Forward && len(history) >= params.Count,
+	}
+	if len(history) > 0 {
+		resp.Cursor = networkid.PaginationCursor(history[0].MessageID)
+	}
+
+	return resp, nil
+}
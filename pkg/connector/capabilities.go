@@ -2,8 +2,16 @@ package connector
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"strings"
 	"time"
 
+	"github.com/duo/matrix-pylon/pkg/ids"
+	"github.com/duo/matrix-pylon/pkg/onebot"
+
+	"github.com/rs/zerolog"
+
 	"go.mau.fi/util/ffmpeg"
 	"go.mau.fi/util/jsontime"
 	"go.mau.fi/util/ptr"
@@ -22,8 +30,11 @@ func supportedIfFFmpeg() event.CapabilitySupportLevel {
 	return event.CapLevelRejected
 }
 
+// Bump capsVersion when the features change, so that clients refetch them
+const capsVersion = 2
+
 func catpID() string {
-	base := "me.lxduo.qq.capabilities.2025_01_16"
+	base := fmt.Sprintf("me.lxduo.qq.capabilities.v%d", capsVersion)
 	if ffmpeg.Supported() {
 		return base + "+ffmpeg"
 	}
@@ -109,13 +120,110 @@ var pylonCaps = &event.RoomFeatures{
 	MaxTextLength:   MaxTextLength,
 	LocationMessage: event.CapLevelFullySupported,
 	Reply:           event.CapLevelFullySupported,
+	Reaction:        event.CapLevelPartialSupport,
 	Delete:          event.CapLevelFullySupported,
 	DeleteForMe:     false,
 	DeleteMaxAge:    ptr.Ptr(jsontime.S(2 * time.Minute)),
 }
 
+// GetCapabilities derives the features of a portal from pylonCaps, the chat type, the role of the
+// user in the group and what the agent reported it can send. Every difference is added to the ID.
 func (pc *PylonClient) GetCapabilities(ctx context.Context, portal *bridgev2.Portal) *event.RoomFeatures {
-	return pylonCaps
+	if pc.client == nil {
+		return pylonCaps
+	}
+
+	caps := *pylonCaps
+	caps.Formatting = maps.Clone(pylonCaps.Formatting)
+	caps.File = maps.Clone(pylonCaps.File)
+	var flags []string
+
+	profile := pc.client.GetProfile()
+	peerType, peerID := ids.ParsePortalID(portal.ID)
+	uploadAction := onebot.UploadPrivateFile
+	if peerType == ids.PeerTypeGroup {
+		flags = append(flags, "group")
+		uploadAction = onebot.UploadGroupFile
+
+		if !profile.SupportsAction(onebot.SetMsgEmojiLike) {
+			flags = append(flags, "noreaction")
+			caps.Reaction = event.CapLevelRejected
+		}
+		if pc.isGroupAdmin(ctx, peerID) {
+			// Owners and admins can recall messages without the time limit
+			flags = append(flags, "admin")
+			caps.DeleteMaxAge = nil
+		}
+	} else {
+		// Mentions and emoji-like reactions only exist in groups
+		caps.Formatting[event.FmtUserLink] = event.CapLevelDropped
+		caps.Reaction = event.CapLevelRejected
+	}
+
+	if threshold := pc.main.Config.LargeFileThreshold; threshold > 0 && !profile.SupportsAction(uploadAction) {
+		// Larger files would have to be uploaded
+		flags = append(flags, "noupload")
+		fileCaps := *caps.File[event.MsgFile]
+		fileCaps.MaxSize = threshold
+		caps.File[event.MsgFile] = &fileCaps
+	}
+
+	if !profile.SupportsSegment(onebot.Reply) {
+		flags = append(flags, "noreply")
+		caps.Reply = event.CapLevelRejected
+	}
+
+	info := pc.client.GetAgentInfo()
+	if !info.CanSendImage || !profile.SupportsSegment(onebot.Image) {
+		flags = append(flags, "noimage")
+		delete(caps.File, event.MsgImage)
+		delete(caps.File, event.CapMsgSticker)
+		delete(caps.File, event.CapMsgGIF)
+	}
+	if !info.CanSendRecord || !profile.SupportsSegment(onebot.Record) {
+		// Audio files are still sent, as plain files
+		flags = append(flags, "norecord")
+		delete(caps.File, event.CapMsgVoice)
+	}
+
+	if len(flags) > 0 {
+		caps.ID += "+" + strings.Join(flags, "+")
+	}
+
+	return &caps
+}
+
+// isGroupAdmin checks whether the user is an owner or admin of the group, as far as it can be known.
+// Capabilities are checked for every message, so this only looks at the roles cached by chat info syncs and notices.
+func (pc *PylonClient) isGroupAdmin(_ context.Context, groupID string) bool {
+	pc.selfRolesLock.Lock()
+	defer pc.selfRolesLock.Unlock()
+
+	return pc.selfRoles[groupID]
+}
+
+// setSelfRole caches the user's role in a group, it returns whether that changes the capabilities
+func (pc *PylonClient) setSelfRole(groupID string, admin bool) bool {
+	pc.selfRolesLock.Lock()
+	defer pc.selfRolesLock.Unlock()
+
+	old := pc.selfRoles[groupID]
+	if admin {
+		pc.selfRoles[groupID] = true
+	} else {
+		delete(pc.selfRoles, groupID)
+	}
+	return old != admin
+}
+
+// updateGroupCapabilities resends the capabilities of a group after the user's role changed
+func (pc *PylonClient) updateGroupCapabilities(ctx context.Context, groupID string) {
+	portal, err := pc.main.Bridge.GetExistingPortalByKey(ctx, pc.makePortalKey(ids.PeerTypeGroup, groupID))
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("group_id", groupID).Msg("Failed to get portal to update capabilities")
+	} else if portal != nil {
+		portal.UpdateCapabilities(ctx, pc.userLogin, true)
+	}
 }
 
 func (pc *PylonConnector) GetCapabilities() *bridgev2.NetworkGeneralCapabilities {
@@ -123,5 +231,5 @@ func (pc *PylonConnector) GetCapabilities() *bridgev2.NetworkGeneralCapabilities
 }
 
 func (pc *PylonConnector) GetBridgeInfoVersion() (info, caps int) {
-	return 1, 1
+	return 1, capsVersion
 }
@@ -26,6 +26,7 @@ import (
 const (
 	DirectChatTopic = "Pylon direct chat"
 
+	powerMuted      = -1
 	powerDefault    = 0
 	powerAdmin      = 50
 	powerSuperAdmin = 75
@@ -102,7 +103,7 @@ func (pc *PylonClient) getDirectChatInfo(recipient string) (*bridgev2.ChatInfo,
 	}, nil
 }
 
-func (pc *PylonClient) getGroupChatInfo(_ context.Context, portal *bridgev2.Portal) (*bridgev2.ChatInfo, error) {
+func (pc *PylonClient) getGroupChatInfo(ctx context.Context, portal *bridgev2.Portal) (*bridgev2.ChatInfo, error) {
 	_, peerID := ids.ParsePortalID(portal.ID)
 
 	groupInfo, err := pc.client.GetGroupInfo(peerID)
@@ -114,10 +115,7 @@ func (pc *PylonClient) getGroupChatInfo(_ context.Context, portal *bridgev2.Port
 		return nil, fmt.Errorf("failed to fetch members %s: %w", peerID, err)
 	}
 
-	avatarURL := groupInfo.Avatar
-	if pc.client.GetAgentType() == onebot.AgentNapCat || pc.client.GetAgentType() == onebot.AgentLLOneBot {
-		avatarURL = util.GetGroupAvatarURL(groupInfo.ID)
-	}
+	avatarURL := pc.client.GetProfile().GroupAvatarURL(groupInfo.ID, groupInfo.Avatar)
 
 	wrapped := &bridgev2.ChatInfo{
 		Name:   ptr.Ptr(groupInfo.Name),
@@ -144,11 +142,10 @@ func (pc *PylonClient) getGroupChatInfo(_ context.Context, portal *bridgev2.Port
 
 	for _, m := range membersInfo {
 		evtSender := pc.makeEventSender(m.UserID)
-		pl := powerDefault
-		if m.Role == "owner" {
-			pl = powerSuperAdmin
-		} else if m.Role == "admin" {
-			pl = powerAdmin
+		pl := memberPowerLevel(m)
+		if evtSender.IsFromMe && pc.setSelfRole(peerID, pl >= powerAdmin) {
+			// Ownership changes have no notice, so this is where they are picked up
+			portal.UpdateCapabilities(ctx, pc.userLogin, true)
 		}
 
 		wrapped.Members.MemberMap[evtSender.Sender] = bridgev2.ChatMember{
@@ -161,11 +158,51 @@ func (pc *PylonClient) getGroupChatInfo(_ context.Context, portal *bridgev2.Port
 	return wrapped, nil
 }
 
-func (pc *PylonClient) contactToUserInfo(contact *onebot.UserInfo) *bridgev2.UserInfo {
-	avatarURL := contact.Avatar
-	if pc.client.GetAgentType() == onebot.AgentNapCat || pc.client.GetAgentType() == onebot.AgentLLOneBot {
-		avatarURL = util.GetUserAvatarURL(contact.ID)
+func (pc *PylonClient) getSelfPowerLevel(groupID string) (int, error) {
+	member, err := pc.client.GetGroupMemberInfo(groupID, string(pc.userLogin.ID))
+	if err != nil {
+		return powerDefault, fmt.Errorf("failed to fetch member info in group %s: %w", groupID, err)
+	}
+	return memberPowerLevel(member), nil
+}
+
+const (
+	roleOwner  = "owner"
+	roleAdmin  = "admin"
+	roleMember = "member"
+)
+
+func memberPowerLevel(member *onebot.MemberInfo) int {
+	if pl := rolePowerLevel(member.Role); pl != powerDefault {
+		return pl
+	} else if member.ShutUpTimestamp > time.Now().Unix() {
+		return powerMuted
 	}
+	return powerDefault
+}
+
+func rolePowerLevel(role string) int {
+	switch role {
+	case roleOwner:
+		return powerSuperAdmin
+	case roleAdmin:
+		return powerAdmin
+	}
+	return powerDefault
+}
+
+func powerLevelRole(pl int) string {
+	switch {
+	case pl >= powerSuperAdmin:
+		return roleOwner
+	case pl >= powerAdmin:
+		return roleAdmin
+	}
+	return roleMember
+}
+
+func (pc *PylonClient) contactToUserInfo(contact *onebot.UserInfo) *bridgev2.UserInfo {
+	avatarURL := pc.client.GetProfile().UserAvatarURL(contact.ID, contact.Avatar)
 
 	return &bridgev2.UserInfo{
 		IsBot:        nil,
@@ -0,0 +1,66 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/duo/matrix-pylon/pkg/onebot"
+)
+
+func TestRolePowerLevel(t *testing.T) {
+	tests := map[string]int{
+		roleOwner:  powerSuperAdmin,
+		roleAdmin:  powerAdmin,
+		roleMember: powerDefault,
+		"":         powerDefault,
+	}
+	for role, want := range tests {
+		if got := rolePowerLevel(role); got != want {
+			t.Errorf("rolePowerLevel(%q) = %d, want %d", role, got, want)
+		}
+	}
+}
+
+func TestPowerLevelRole(t *testing.T) {
+	tests := map[int]string{
+		100:             roleOwner,
+		powerSuperAdmin: roleOwner,
+		74:              roleAdmin,
+		powerAdmin:      roleAdmin,
+		49:              roleMember,
+		powerDefault:    roleMember,
+		powerMuted:      roleMember,
+	}
+	for pl, want := range tests {
+		if got := powerLevelRole(pl); got != want {
+			t.Errorf("powerLevelRole(%d) = %q, want %q", pl, got, want)
+		}
+	}
+
+	// Roles survive the round trip through power levels
+	for _, role := range []string{roleOwner, roleAdmin, roleMember} {
+		if got := powerLevelRole(rolePowerLevel(role)); got != role {
+			t.Errorf("powerLevelRole(rolePowerLevel(%q)) = %q", role, got)
+		}
+	}
+}
+
+func TestMemberPowerLevel(t *testing.T) {
+	muted := time.Now().Add(time.Hour).Unix()
+	expired := time.Now().Add(-time.Hour).Unix()
+
+	tests := []struct {
+		member *onebot.MemberInfo
+		want   int
+	}{
+		{&onebot.MemberInfo{Role: roleOwner}, powerSuperAdmin},
+		{&onebot.MemberInfo{Role: roleAdmin, ShutUpTimestamp: muted}, powerAdmin},
+		{&onebot.MemberInfo{Role: roleMember, ShutUpTimestamp: muted}, powerMuted},
+		{&onebot.MemberInfo{Role: roleMember, ShutUpTimestamp: expired}, powerDefault},
+	}
+	for _, tt := range tests {
+		if got := memberPowerLevel(tt.member); got != tt.want {
+			t.Errorf("memberPowerLevel(%+v) = %d, want %d", tt.member, got, tt.want)
+		}
+	}
+}
@@ -21,18 +21,38 @@ type resyncQueueItem struct {
 type PylonClient struct {
 	main      *PylonConnector
 	userLogin *bridgev2.UserLogin
-	client    *onebot.Client
+	client    onebot.API
 
 	stopLoops       atomic.Pointer[context.CancelFunc]
 	resyncQueue     map[string]resyncQueueItem
 	resyncQueueLock sync.Mutex
 	nextResync      time.Time
+
+	// Guards the pending requests in the login metadata
+	pendingRequestsLock sync.Mutex
+
+	// Groups where the user is an owner or admin
+	selfRoles     map[string]bool
+	selfRolesLock sync.Mutex
+
+	pendingUploads     map[string]time.Time
+	pendingUploadsLock sync.Mutex
+
+	muteTimers     map[string]*time.Timer
+	muteTimersLock sync.Mutex
 }
 
 var (
 	_ bridgev2.NetworkAPI                    = (*PylonClient)(nil)
 	_ bridgev2.IdentifierResolvingNetworkAPI = (*PylonClient)(nil)
 	_ bridgev2.RedactionHandlingNetworkAPI   = (*PylonClient)(nil)
+	_ bridgev2.PowerLevelHandlingNetworkAPI  = (*PylonClient)(nil)
+	_ bridgev2.MembershipHandlingNetworkAPI  = (*PylonClient)(nil)
+	_ bridgev2.RoomNameHandlingNetworkAPI    = (*PylonClient)(nil)
+	_ bridgev2.RoomAvatarHandlingNetworkAPI  = (*PylonClient)(nil)
+	_ bridgev2.BackfillingNetworkAPI         = (*PylonClient)(nil)
+	_ bridgev2.ReadReceiptHandlingNetworkAPI = (*PylonClient)(nil)
+	_ bridgev2.ReactionHandlingNetworkAPI    = (*PylonClient)(nil)
 )
 
 func (pc *PylonClient) Connect(ctx context.Context) {
@@ -46,6 +66,14 @@ func (pc *PylonClient) Connect(ctx context.Context) {
 	}
 
 	pc.client.SetEventHandler(pc.handleOnebotEvent)
+	pc.client.SetStatusHandler(pc.handleStatus)
+	loginMetadata := pc.userLogin.Metadata.(*UserLoginMetadata)
+	pc.client.Start(onebot.TransportMode(loginMetadata.Transport), loginMetadata.Endpoint)
+	if clientStatus := pc.client.GetStatus(); clientStatus == onebot.StatusUnknown {
+		pc.userLogin.BridgeState.Send(status.BridgeState{StateEvent: status.StateConnecting})
+	} else {
+		pc.handleStatus(clientStatus)
+	}
 
 	pc.startLoops()
 }
@@ -55,8 +83,10 @@ func (pc *PylonClient) Disconnect() {
 	if stopSyncLoop := pc.stopLoops.Swap(nil); stopSyncLoop != nil {
 		(*stopSyncLoop)()
 	}
+	pc.stopAllUnmutes()
 
 	pc.client.Release()
+	pc.main.MsgConv.ForgetClient(pc.client)
 }
 
 func (pc *PylonClient) LogoutRemote(ctx context.Context) {
@@ -64,7 +94,41 @@ func (pc *PylonClient) LogoutRemote(ctx context.Context) {
 }
 
 func (pc *PylonClient) IsLoggedIn() bool {
-	return pc.client != nil && pc.client.IsLoggedIn()
+	// Requests made while the agent is reconnecting are queued instead of failing
+	return pc.client != nil && (pc.client.IsLoggedIn() || pc.client.IsReconnecting())
+}
+
+func (pc *PylonClient) handleStatus(clientStatus onebot.ClientStatus) {
+	state := status.BridgeState{}
+
+	switch clientStatus {
+	case onebot.StatusConnected:
+		state.StateEvent = status.StateConnected
+	case onebot.StatusDisconnected:
+		state.StateEvent = status.StateTransientDisconnect
+		state.Error = "pylon-agent-disconnected"
+		state.Message = "The agent disconnected, waiting for it to reconnect"
+	case onebot.StatusHeartbeatTimeout:
+		state.StateEvent = status.StateTransientDisconnect
+		state.Error = "pylon-heartbeat-timeout"
+		state.Message = "No heartbeat received from the agent"
+	case onebot.StatusOffline:
+		state.StateEvent = status.StateUnknownError
+		state.Error = "pylon-qq-offline"
+		state.Message = "The agent reports that the account is offline"
+	case onebot.StatusUnhealthy:
+		state.StateEvent = status.StateUnknownError
+		state.Error = "pylon-agent-unhealthy"
+		state.Message = "The agent reports that it isn't working properly"
+	case onebot.StatusDisabled:
+		state.StateEvent = status.StateUnknownError
+		state.Error = "pylon-agent-disabled"
+		state.Message = "OneBot was disabled in the agent"
+	default:
+		return
+	}
+
+	pc.userLogin.BridgeState.Send(state)
 }
 
 func (pc *PylonClient) IsThisUser(ctx context.Context, userID networkid.UserID) bool {
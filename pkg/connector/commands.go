@@ -0,0 +1,186 @@
+package connector
+
+import (
+	"strings"
+
+	"github.com/duo/matrix-pylon/pkg/ids"
+
+	"maunium.net/go/mautrix/bridgev2/commands"
+	"maunium.net/go/mautrix/id"
+)
+
+var HelpSectionRequests = commands.HelpSection{Name: "Friend and group requests", Order: 25}
+
+var cmdApprove = &commands.FullHandler{
+	Func: fnRespondRequest,
+	Name: "approve",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionRequests,
+		Description: "Approve a friend or group request",
+		Args:        "<_flag_>",
+	},
+	RequiresLogin: true,
+}
+
+var cmdReject = &commands.FullHandler{
+	Func: fnRespondRequest,
+	Name: "reject",
+	Help: commands.HelpMeta{
+		Section:     HelpSectionRequests,
+		Description: "Reject a friend or group request",
+		Args:        "<_flag_> [_reason_]",
+	},
+	RequiresLogin: true,
+}
+
+func fnRespondRequest(ce *commands.Event) {
+	if len(ce.Args) == 0 {
+		ce.Reply("**Usage:** `$cmdprefix %s %s`", ce.Command, ce.Handler.(*commands.FullHandler).Help.Args)
+		return
+	}
+
+	flag := ce.Args[0]
+	approve := ce.Command == "approve"
+	reason := strings.Join(ce.Args[1:], " ")
+
+	for _, login := range ce.User.GetUserLogins() {
+		pc, ok := login.Client.(*PylonClient)
+		if !ok || !pc.IsLoggedIn() {
+			continue
+		}
+		req := pc.getPendingRequest(flag)
+		if req == nil {
+			continue
+		}
+
+		if err := pc.respondRequest(flag, req, approve, reason); err != nil {
+			ce.Reply("Failed to %s request: %v", ce.Command, err)
+		} else if approve {
+			pc.removePendingRequest(ce.Ctx, flag)
+			ce.Reply("Approved request %s.", flag)
+		} else {
+			pc.removePendingRequest(ce.Ctx, flag)
+			ce.Reply("Rejected request %s.", flag)
+		}
+		return
+	}
+
+	ce.Reply("Unknown request %s", flag)
+}
+
+var cmdForward = &commands.FullHandler{
+	Func: fnForward,
+	Name: "forward",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionChats,
+		Description: "Send a range of messages, or the thread started by a message, to a QQ chat as a merged-forward message",
+		Args:        "<_group|user_> <_ID_> [_start event ID_] [_end event ID_]",
+	},
+	RequiresPortal: true,
+	RequiresLogin:  true,
+}
+
+func fnForward(ce *commands.Event) {
+	if len(ce.Args) < 2 || (len(ce.Args) < 3 && ce.ReplyTo == "") {
+		ce.Reply("**Usage:** `$cmdprefix forward %s`\n\n"+
+			"Without an end event, the thread of the start event is forwarded. "+
+			"The start event defaults to the message being replied to.", ce.Handler.(*commands.FullHandler).Help.Args)
+		return
+	}
+
+	peerType := ids.PeerType(strings.ToLower(ce.Args[0]))
+	if peerType != ids.PeerTypeGroup && peerType != ids.PeerTypeUser {
+		ce.Reply("Unknown chat type %s, must be `group` or `user`", ce.Args[0])
+		return
+	}
+	peerID := ce.Args[1]
+
+	start, end := ce.ReplyTo, id.EventID("")
+	if len(ce.Args) > 2 {
+		start = id.EventID(ce.Args[2])
+	}
+	if len(ce.Args) > 3 {
+		end = id.EventID(ce.Args[3])
+	}
+
+	login, _, err := ce.Portal.FindPreferredLogin(ce.Ctx, ce.User, false)
+	if err != nil || login == nil {
+		ce.Reply("You're not logged in to this chat")
+		return
+	}
+	pc, ok := login.Client.(*PylonClient)
+	if !ok || !pc.IsLoggedIn() {
+		ce.Reply("You're not logged in to this chat")
+		return
+	}
+
+	messages, err := pc.collectForwardMessages(ce.Ctx, ce.Portal, start, end)
+	if err != nil {
+		ce.Reply("Failed to collect messages: %v", err)
+		return
+	}
+
+	if len(messages) > maxForwardNodes {
+		ce.Reply("Too many messages (%d), at most %d can be forwarded at once", len(messages), maxForwardNodes)
+		return
+	}
+
+	nodes := pc.buildForwardNodes(ce.Ctx, messages)
+	if len(nodes) == 0 {
+		ce.Reply("No messages to forward")
+		return
+	}
+
+	if _, err := pc.sendForward(peerType, peerID, nodes); err != nil {
+		ce.Reply("Failed to send forward message: %v", err)
+	} else {
+		ce.Reply("Forwarded %d messages to %s %s.", len(nodes), peerType, peerID)
+	}
+}
+
+var cmdPoke = &commands.FullHandler{
+	Func: fnPoke,
+	Name: "poke",
+	Help: commands.HelpMeta{
+		Section:     commands.HelpSectionChats,
+		Description: "Poke a user in the current chat",
+		Args:        "[_QQ ID or Matrix user ID_]",
+	},
+	RequiresPortal: true,
+	RequiresLogin:  true,
+}
+
+func fnPoke(ce *commands.Event) {
+	// The target can be omitted in private chats
+	peerType, target := ids.ParsePortalID(ce.Portal.ID)
+	if len(ce.Args) > 0 {
+		target = ce.Args[0]
+	} else if peerType != ids.PeerTypeUser {
+		ce.Reply("**Usage:** `$cmdprefix poke %s`", ce.Handler.(*commands.FullHandler).Help.Args)
+		return
+	}
+
+	if strings.HasPrefix(target, "@") {
+		userID, ok := ce.Bridge.Matrix.ParseGhostMXID(id.UserID(target))
+		if !ok {
+			ce.Reply("%s is not a QQ user", target)
+			return
+		}
+		target = string(userID)
+	}
+
+	login, _, err := ce.Portal.FindPreferredLogin(ce.Ctx, ce.User, false)
+	if err != nil || login == nil {
+		ce.Reply("You're not logged in to this chat")
+		return
+	}
+	pc, ok := login.Client.(*PylonClient)
+	if !ok || !pc.IsLoggedIn() {
+		ce.Reply("You're not logged in to this chat")
+		return
+	}
+
+	if err := pc.sendPoke(ce.Portal, target); err != nil {
+		ce.Reply("Failed to poke %s: %v", target, err)
+	}
+}
@@ -1,6 +1,7 @@
 package connector
 
 import (
+	"fmt"
 	"strings"
 	"text/template"
 	"time"
@@ -15,13 +16,32 @@ import (
 //go:embed example-config.yaml
 var ExampleConfig string
 
+const (
+	defaultMuteDuration = 10 * time.Minute
+	// QQ doesn't mute members for longer than 30 days
+	maxMuteDuration = 30 * 24 * time.Hour
+)
+
 type Config struct {
 	DisplaynameTemplate string             `yaml:"displayname_template"`
 	displaynameTemplate *template.Template `yaml:"-"`
 
+	MuteDuration       time.Duration `yaml:"mute_duration"`
+	ConfirmGroupLeave  bool          `yaml:"confirm_group_leave"`
+	LargeFileThreshold int64         `yaml:"large_file_threshold"`
+
 	Onebot struct {
 		Endpoint       string        `yaml:"endpoint"`
 		RequestTimeout time.Duration `yaml:"request_timeout"`
+		ReconnectGrace time.Duration `yaml:"reconnect_grace_period"`
+
+		Media struct {
+			Mode           string        `yaml:"mode"`
+			PublicURL      string        `yaml:"public_url"`
+			Directory      string        `yaml:"directory"`
+			AgentDirectory string        `yaml:"agent_directory"`
+			TTL            time.Duration `yaml:"ttl"`
+		} `yaml:"media"`
 	} `yaml:"onebot"`
 }
 
@@ -36,6 +56,13 @@ func (c *Config) UnmarshalYAML(node *yaml.Node) error {
 }
 
 func (c *Config) PostProcess() error {
+	// Agents mute in whole seconds and take 0 as unmute
+	if c.MuteDuration < time.Second {
+		c.MuteDuration = defaultMuteDuration
+	} else if c.MuteDuration > maxMuteDuration {
+		return fmt.Errorf("mute_duration %s is longer than the maximum of %s", c.MuteDuration, maxMuteDuration)
+	}
+
 	var err error
 	c.displaynameTemplate, err = template.New("displayname").Parse(c.DisplaynameTemplate)
 	return err
@@ -43,9 +70,18 @@ func (c *Config) PostProcess() error {
 
 func upgradeConfig(helper up.Helper) {
 	helper.Copy(up.Str, "displayname_template")
+	helper.Copy(up.Str, "mute_duration")
+	helper.Copy(up.Bool, "confirm_group_leave")
+	helper.Copy(up.Int, "large_file_threshold")
 
 	helper.Copy(up.Str, "onebot", "endpoint")
 	helper.Copy(up.Str, "onebot", "request_timeout")
+	helper.Copy(up.Str, "onebot", "reconnect_grace_period")
+	helper.Copy(up.Str, "onebot", "media", "mode")
+	helper.Copy(up.Str, "onebot", "media", "public_url")
+	helper.Copy(up.Str, "onebot", "media", "directory")
+	helper.Copy(up.Str, "onebot", "media", "agent_directory")
+	helper.Copy(up.Str, "onebot", "media", "ttl")
 }
 
 func (pc *PylonConnector) GetConfig() (example string, data any, upgrader up.Upgrader) {
@@ -0,0 +1,32 @@
+package connector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigMuteDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     time.Duration
+		wantErr  bool
+	}{
+		{0, defaultMuteDuration, false},
+		{-time.Minute, defaultMuteDuration, false},
+		{500 * time.Millisecond, defaultMuteDuration, false},
+		{time.Hour, time.Hour, false},
+		{maxMuteDuration, maxMuteDuration, false},
+		{maxMuteDuration + time.Second, 0, true},
+	}
+	for _, tt := range tests {
+		c := &Config{MuteDuration: tt.duration}
+		err := c.PostProcess()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("PostProcess with mute_duration %s didn't fail", tt.duration)
+			}
+		} else if err != nil || c.MuteDuration != tt.want {
+			t.Errorf("PostProcess with mute_duration %s = %s, %v, want %s", tt.duration, c.MuteDuration, err, tt.want)
+		}
+	}
+}
@@ -2,11 +2,16 @@ package connector
 
 import (
 	"context"
+	"time"
 
 	"github.com/duo/matrix-pylon/pkg/msgconv"
 	"github.com/duo/matrix-pylon/pkg/onebot"
+	"github.com/duo/matrix-pylon/pkg/satori"
+
+	"github.com/rs/zerolog"
 
 	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/commands"
 )
 
 var (
@@ -25,10 +30,20 @@ type PylonConnector struct {
 func (pc *PylonConnector) Init(bridge *bridgev2.Bridge) {
 	pc.Bridge = bridge
 	pc.MsgConv = msgconv.NewMessageConverter(bridge)
+	pc.MsgConv.LargeFileThreshold = pc.Config.LargeFileThreshold
+	bridge.Commands.(*commands.Processor).AddHandlers(cmdApprove, cmdReject, cmdForward, cmdPoke)
 	pc.Service = onebot.NewService(
 		bridge.Log,
 		pc.Config.Onebot.Endpoint,
 		pc.Config.Onebot.RequestTimeout,
+		pc.Config.Onebot.ReconnectGrace,
+		onebot.MediaConfig{
+			Mode:           onebot.MediaMode(pc.Config.Onebot.Media.Mode),
+			PublicURL:      pc.Config.Onebot.Media.PublicURL,
+			Directory:      pc.Config.Onebot.Media.Directory,
+			AgentDirectory: pc.Config.Onebot.Media.AgentDirectory,
+			TTL:            pc.Config.Onebot.Media.TTL,
+		},
 	)
 }
 
@@ -59,20 +74,32 @@ func (pc *PylonConnector) GetName() bridgev2.BridgeName {
 
 func (pc *PylonConnector) LoadUserLogin(ctx context.Context, login *bridgev2.UserLogin) error {
 	p := &PylonClient{
-		main:        pc,
-		userLogin:   login,
-		resyncQueue: make(map[string]resyncQueueItem),
+		main:           pc,
+		userLogin:      login,
+		resyncQueue:    make(map[string]resyncQueueItem),
+		selfRoles:      make(map[string]bool),
+		pendingUploads: make(map[string]time.Time),
+		muteTimers:     make(map[string]*time.Timer),
 	}
 	login.Client = p
 
 	loginMetadata := login.Metadata.(*UserLoginMetadata)
-	if len(loginMetadata.Token) == 0 {
+	if len(loginMetadata.Token) == 0 && loginMetadata.Protocol != ProtocolSatori {
 		p.userLogin.Log.Warn().Msg("No token found for user")
 	} else {
 		loginID := string(login.ID)
 		log := p.userLogin.Log.With().Str("user_login_id", loginID).Logger()
-		p.client = pc.Service.NewClient(log, loginID, loginMetadata.Token)
+		p.client = pc.newNetworkClient(log, loginID, loginMetadata)
 	}
 
 	return nil
 }
+
+// newNetworkClient creates the client for the backend a login uses
+func (pc *PylonConnector) newNetworkClient(log zerolog.Logger, id string, metadata *UserLoginMetadata) onebot.API {
+	if metadata.Protocol == ProtocolSatori {
+		return satori.NewClient(log, id, metadata.Token, pc.Config.Onebot.RequestTimeout)
+	}
+
+	return pc.Service.NewClient(log, id, metadata.Token)
+}
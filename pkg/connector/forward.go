@@ -0,0 +1,141 @@
+package connector
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/duo/matrix-pylon/pkg/ids"
+	"github.com/duo/matrix-pylon/pkg/onebot"
+
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/id"
+)
+
+// QQ refuses merged-forward messages with too many nodes
+const maxForwardNodes = 100
+
+// collectForwardMessages returns the bridged messages of a portal between two events (inclusive),
+// or the thread rooted at start if end is empty.
+func (pc *PylonClient) collectForwardMessages(ctx context.Context, portal *bridgev2.Portal, start, end id.EventID) ([]*database.Message, error) {
+	db := pc.main.Bridge.DB.Message
+
+	first, err := db.GetPartByMXID(ctx, start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get start message: %w", err)
+	} else if first == nil || first.Room != portal.PortalKey {
+		return nil, fmt.Errorf("unknown message %s", start)
+	}
+
+	until := time.Now()
+	if end != "" {
+		last, err := db.GetPartByMXID(ctx, end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get end message: %w", err)
+		} else if last == nil || last.Room != portal.PortalKey {
+			return nil, fmt.Errorf("unknown message %s", end)
+		}
+		if last.Timestamp.Before(first.Timestamp) {
+			first, last = last, first
+		}
+		until = last.Timestamp
+	}
+
+	messages, err := db.GetMessagesBetweenTimeQuery(ctx, portal.PortalKey, first.Timestamp.Add(-time.Nanosecond), until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	slices.SortStableFunc(messages, func(a, b *database.Message) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	seen := make(map[networkid.MessageID]struct{})
+	result := make([]*database.Message, 0, len(messages))
+	for _, msg := range messages {
+		if end == "" && msg.ID != first.ID && msg.ThreadRoot != first.ID {
+			continue
+		}
+		// Attachments of a single message are stored as extra parts
+		if _, ok := seen[msg.ID]; ok {
+			continue
+		}
+		seen[msg.ID] = struct{}{}
+		result = append(result, msg)
+	}
+
+	return result, nil
+}
+
+// buildForwardNodes fetches the original content of the messages and wraps each one in a node segment.
+func (pc *PylonClient) buildForwardNodes(ctx context.Context, messages []*database.Message) []onebot.ISegment {
+	log := pc.userLogin.Log
+
+	nodes := make([]onebot.ISegment, 0, len(messages))
+	for _, msg := range messages {
+		// Bridge notices only exist on Matrix
+		_, messageID, err := ids.ParseMessageID(msg.ID)
+		if err != nil {
+			continue
+		}
+
+		original, err := pc.client.GetMessage(messageID)
+		if err != nil {
+			log.Warn().Err(err).Str("message_id", messageID).Msg("Failed to get message for forwarding")
+			continue
+		}
+
+		segments, _ := original.Message.([]onebot.ISegment)
+		content := make([]onebot.ISegment, 0, len(segments))
+		for _, s := range segments {
+			// Replies can't be resolved inside a merged-forward message
+			if s.SegmentType() != onebot.Reply {
+				content = append(content, s)
+			}
+		}
+		if len(content) == 0 {
+			continue
+		}
+
+		uin := cmp.Or(original.Sender.UserID, string(msg.SenderID))
+		nodes = append(nodes, onebot.NewNode(pc.forwardSenderName(ctx, msg.SenderID, original), uin, content))
+	}
+
+	return nodes
+}
+
+func (pc *PylonClient) forwardSenderName(ctx context.Context, sender networkid.UserID, original *onebot.Message) string {
+	if networkid.UserLoginID(sender) == pc.userLogin.ID && pc.userLogin.RemoteName != "" {
+		return pc.userLogin.RemoteName
+	}
+	if ghost, err := pc.main.Bridge.GetGhostByID(ctx, sender); err == nil && ghost.Name != "" {
+		return ghost.Name
+	}
+
+	return cmp.Or(original.Sender.Card, original.Sender.Nickname, string(sender))
+}
+
+func (pc *PylonClient) sendForward(peerType ids.PeerType, peerID string, nodes []onebot.ISegment) (*onebot.SendMessageResponse, error) {
+	if pc.supportsAction(onebot.SendForwardMsg) {
+		switch peerType {
+		case ids.PeerTypeUser:
+			return pc.client.SendForwardMessage("private", peerID, nodes)
+		case ids.PeerTypeGroup:
+			return pc.client.SendForwardMessage("group", peerID, nodes)
+		}
+	} else if pc.supportsAction(onebot.SendGroupForwardMsg) {
+		switch peerType {
+		case ids.PeerTypeUser:
+			return pc.client.SendPrivateForwardMessage(peerID, nodes)
+		case ids.PeerTypeGroup:
+			return pc.client.SendGroupForwardMessage(peerID, nodes)
+		}
+	} else {
+		return nil, pc.checkAction(onebot.SendForwardMsg)
+	}
+
+	return nil, fmt.Errorf("unsupported chat type %s", peerType)
+}
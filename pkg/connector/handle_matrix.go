@@ -1,18 +1,31 @@
 package connector
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/duo/matrix-pylon/pkg/ids"
 	"github.com/duo/matrix-pylon/pkg/onebot"
 
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/rs/zerolog"
 	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/bridgev2/commands"
 	"maunium.net/go/mautrix/bridgev2/database"
+	"maunium.net/go/mautrix/bridgev2/matrix"
 	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+	"maunium.net/go/mautrix/id"
 )
 
+// Kick reasons containing this flag also reject future join requests of the user
+const rejectAddRequestFlag = "#reject"
+
 func (pc *PylonClient) HandleMatrixMessage(ctx context.Context, msg *bridgev2.MatrixMessage) (*bridgev2.MatrixMessageResponse, error) {
 	if !pc.IsLoggedIn() {
 		return nil, bridgev2.ErrNotLoggedIn
@@ -21,9 +34,21 @@ func (pc *PylonClient) HandleMatrixMessage(ctx context.Context, msg *bridgev2.Ma
 	segments, err := pc.main.MsgConv.ToOnebot(ctx, pc.client, msg.Event, msg.Content, msg.Portal)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert message: %w", err)
+	} else if len(segments) == 0 {
+		// Large files are uploaded to the chat's file area and have no message ID
+		_, peerID := ids.ParsePortalID(msg.Portal.ID)
+		pc.addPendingUpload(peerID, cmp.Or(msg.Content.FileName, msg.Content.Body))
+		return &bridgev2.MatrixMessageResponse{
+			DB: &database.Message{
+				ID:        ids.MakeFakeMessageID(peerID, fmt.Sprintf("upload-%s", msg.Event.ID)),
+				SenderID:  networkid.UserID(pc.userLogin.ID),
+				Timestamp: time.Now(),
+			},
+		}, nil
 	}
 
-	if msg.ReplyTo != nil {
+	// Agents without replies get the message alone
+	if msg.ReplyTo != nil && pc.client.GetProfile().SupportsSegment(onebot.Reply) {
 		if _, msgID, err := ids.ParseMessageID(msg.ReplyTo.ID); err != nil {
 			return nil, err
 		} else {
@@ -68,3 +93,389 @@ func (pc *PylonClient) HandleMatrixMessageRemove(ctx context.Context, msg *bridg
 
 	return pc.client.DeleteMessage(messageID)
 }
+
+func (pc *PylonClient) PreHandleMatrixReaction(ctx context.Context, msg *bridgev2.MatrixReaction) (bridgev2.MatrixReactionPreResponse, error) {
+	if peerType, _ := ids.ParsePortalID(msg.Portal.ID); peerType != ids.PeerTypeGroup {
+		return bridgev2.MatrixReactionPreResponse{}, fmt.Errorf("reactions are only supported in groups")
+	}
+	if !pc.client.GetProfile().SupportsAction(onebot.SetMsgEmojiLike) {
+		return bridgev2.MatrixReactionPreResponse{}, fmt.Errorf("reactions are not supported by the agent")
+	}
+
+	key := msg.Content.RelatesTo.Key
+	emojiID, ok := pc.client.GetProfile().ReactionToFace(key)
+	if !ok {
+		return bridgev2.MatrixReactionPreResponse{}, fmt.Errorf("unsupported reaction %s", key)
+	}
+
+	return bridgev2.MatrixReactionPreResponse{
+		SenderID: networkid.UserID(pc.userLogin.ID),
+		EmojiID:  networkid.EmojiID(emojiID),
+		Emoji:    key,
+	}, nil
+}
+
+func (pc *PylonClient) HandleMatrixReaction(ctx context.Context, msg *bridgev2.MatrixReaction) (*database.Reaction, error) {
+	if !pc.IsLoggedIn() {
+		return nil, bridgev2.ErrNotLoggedIn
+	}
+
+	_, messageID, err := ids.ParseMessageID(msg.TargetMessage.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pc.client.SetMsgEmojiLike(messageID, string(msg.PreHandleResp.EmojiID), true); err != nil {
+		return nil, err
+	}
+
+	return &database.Reaction{}, nil
+}
+
+func (pc *PylonClient) HandleMatrixReactionRemove(ctx context.Context, msg *bridgev2.MatrixReactionRemove) error {
+	if !pc.IsLoggedIn() {
+		return bridgev2.ErrNotLoggedIn
+	}
+
+	_, messageID, err := ids.ParseMessageID(msg.TargetReaction.MessageID)
+	if err != nil {
+		return err
+	}
+
+	return pc.client.SetMsgEmojiLike(messageID, string(msg.TargetReaction.EmojiID), false)
+}
+
+func (pc *PylonClient) sendPoke(portal *bridgev2.Portal, userID string) error {
+	peerType, peerID := ids.ParsePortalID(portal.ID)
+	switch peerType {
+	case ids.PeerTypeUser:
+		if !pc.supportsAction(onebot.FriendPoke) {
+			return fmt.Errorf("poke is not supported by the agent")
+		}
+		return pc.client.FriendPoke(peerID)
+	case ids.PeerTypeGroup:
+		if !pc.supportsAction(onebot.GroupPoke) {
+			return fmt.Errorf("poke is not supported by the agent")
+		}
+		return pc.client.GroupPoke(peerID, userID)
+	default:
+		return fmt.Errorf("unsupported chat type %s", peerType)
+	}
+}
+
+func (pc *PylonClient) HandleMatrixReadReceipt(ctx context.Context, msg *bridgev2.MatrixReadReceipt) error {
+	if !pc.IsLoggedIn() {
+		return bridgev2.ErrNotLoggedIn
+	}
+
+	peerType, peerID := ids.ParsePortalID(msg.Portal.ID)
+
+	profile := pc.client.GetProfile()
+
+	// NapCat marks the whole conversation as read
+	if profile.SupportsAction(onebot.MarkPrivateMsgAsRead) {
+		switch peerType {
+		case ids.PeerTypeUser:
+			return pc.client.MarkPrivateMsgAsRead(peerID)
+		case ids.PeerTypeGroup:
+			return pc.client.MarkGroupMsgAsRead(peerID)
+		default:
+			return fmt.Errorf("unsupported chat type %s", peerType)
+		}
+	}
+
+	if !profile.SupportsAction(onebot.MarkMsgAsRead) {
+		return nil
+	}
+
+	target := msg.ExactMessage
+	if target == nil {
+		var err error
+		target, err = pc.main.Bridge.DB.Message.GetLastPartAtOrBeforeTime(ctx, msg.Portal.PortalKey, msg.ReadUpTo)
+		if err != nil {
+			return fmt.Errorf("failed to get last message before receipt: %w", err)
+		} else if target == nil {
+			return nil
+		}
+	}
+
+	// Notices bridged with fake IDs don't exist on the agent side
+	_, messageID, err := ids.ParseMessageID(target.ID)
+	if err != nil {
+		return nil
+	}
+
+	return pc.client.MarkMsgAsRead(messageID)
+}
+
+func (pc *PylonClient) HandleMatrixMembership(ctx context.Context, msg *bridgev2.MatrixMembershipChange) (bool, error) {
+	if !pc.IsLoggedIn() {
+		return false, bridgev2.ErrNotLoggedIn
+	}
+
+	peerType, peerID := ids.ParsePortalID(msg.Portal.ID)
+	if peerType != ids.PeerTypeGroup {
+		return false, nil
+	}
+
+	switch msg.Type {
+	case bridgev2.Kick, bridgev2.BanJoined:
+		var targetID string
+		switch target := msg.Target.(type) {
+		case *bridgev2.Ghost:
+			targetID = string(target.ID)
+		case *bridgev2.UserLogin:
+			targetID = string(target.ID)
+		default:
+			return false, nil
+		}
+
+		rejectAddRequest := msg.Type == bridgev2.BanJoined || strings.Contains(msg.Content.Reason, rejectAddRequestFlag)
+		if err := pc.client.SetGroupKick(peerID, targetID, rejectAddRequest); err != nil {
+			return false, err
+		}
+		return true, nil
+	case bridgev2.ProfileChange:
+		if msg.Content.Displayname == msg.PrevContent.Displayname || !pc.supportsAction(onebot.SetGroupCard) {
+			return false, nil
+		}
+		globalName, err := pc.globalDisplayname(ctx, msg.Event.Sender)
+		if err != nil {
+			return false, fmt.Errorf("failed to get global displayname: %w", err)
+		}
+		card, ok := roomNick(msg.Content, msg.PrevContent, globalName)
+		if !ok {
+			return false, nil
+		}
+		if err := pc.client.SetGroupCard(peerID, string(pc.userLogin.ID), card); err != nil {
+			return false, err
+		}
+		return true, nil
+	case bridgev2.Leave:
+		// Leaving the portal is enough if the agent can't leave groups
+		if !pc.supportsAction(onebot.SetGroupLeave) {
+			return false, nil
+		}
+		if pc.main.Config.ConfirmGroupLeave {
+			pc.confirmGroupLeave(ctx, msg.Portal, peerID)
+			return true, nil
+		}
+		if err := pc.client.SetGroupLeave(peerID); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// roomNick returns the per-room displayname set in a member event.
+// Global profile renames are copied into every room and aren't room nicks.
+func roomNick(content, prevContent *event.MemberEventContent, globalName string) (string, bool) {
+	if content.Displayname == prevContent.Displayname || content.Displayname == globalName {
+		return "", false
+	}
+	return content.Displayname, true
+}
+
+func (pc *PylonClient) globalDisplayname(ctx context.Context, userID id.UserID) (string, error) {
+	connector, ok := pc.main.Bridge.Matrix.(*matrix.Connector)
+	if !ok {
+		return "", fmt.Errorf("unsupported matrix connector %T", pc.main.Bridge.Matrix)
+	}
+	profile, err := connector.Bot.GetProfile(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return profile.DisplayName, nil
+}
+
+func (pc *PylonClient) confirmGroupLeave(ctx context.Context, portal *bridgev2.Portal, groupID string) {
+	log := zerolog.Ctx(ctx)
+
+	user := pc.userLogin.User
+	roomID, err := user.GetManagementRoom(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to get management room")
+		return
+	}
+
+	groupName := cmp.Or(portal.Name, groupID)
+	commands.StoreCommandState(user, &commands.CommandState{
+		Action: "Leave group",
+		Next: commands.MinimalCommandHandlerFunc(func(ce *commands.Event) {
+			commands.StoreCommandState(ce.User, nil)
+			if !strings.EqualFold(strings.TrimSpace(ce.RawArgs), "confirm") {
+				ce.Reply("Staying in %s.", groupName)
+			} else if err := pc.client.SetGroupLeave(groupID); err != nil {
+				ce.Reply("Failed to leave %s: %v", groupName, err)
+			} else {
+				ce.Reply("Left %s.", groupName)
+			}
+		}),
+	})
+
+	content := format.RenderMarkdown(fmt.Sprintf(
+		"You left the portal of %s. Reply `confirm` to also leave the group, or `%s cancel` to stay in it.",
+		groupName, pc.main.Bridge.Config.CommandPrefix,
+	), true, false)
+	content.MsgType = event.MsgNotice
+	if _, err := pc.main.Bridge.Bot.SendMessage(ctx, roomID, event.EventMessage, &event.Content{Parsed: &content}, nil); err != nil {
+		log.Err(err).Msg("Failed to send group leave confirmation")
+	}
+}
+
+func (pc *PylonClient) HandleMatrixRoomName(ctx context.Context, msg *bridgev2.MatrixRoomName) (bool, error) {
+	if !pc.IsLoggedIn() {
+		return false, bridgev2.ErrNotLoggedIn
+	}
+
+	peerType, peerID := ids.ParsePortalID(msg.Portal.ID)
+	if peerType != ids.PeerTypeGroup {
+		return false, nil
+	}
+
+	if err := pc.checkAction(onebot.SetGroupName); err != nil {
+		return false, err
+	}
+	if err := pc.ensureGroupAdmin(peerID); err != nil {
+		return false, err
+	}
+	if err := pc.client.SetGroupName(peerID, msg.Content.Name); err != nil {
+		return false, err
+	}
+
+	msg.Portal.Name = msg.Content.Name
+	msg.Portal.NameSet = true
+
+	return true, nil
+}
+
+func (pc *PylonClient) HandleMatrixRoomAvatar(ctx context.Context, msg *bridgev2.MatrixRoomAvatar) (bool, error) {
+	if !pc.IsLoggedIn() {
+		return false, bridgev2.ErrNotLoggedIn
+	}
+
+	peerType, peerID := ids.ParsePortalID(msg.Portal.ID)
+	if peerType != ids.PeerTypeGroup || msg.Content.URL == "" {
+		return false, nil
+	}
+
+	if err := pc.checkAction(onebot.SetGroupPortrait); err != nil {
+		return false, err
+	}
+	if err := pc.ensureGroupAdmin(peerID); err != nil {
+		return false, err
+	}
+
+	data, err := pc.main.Bridge.Bot.DownloadMedia(ctx, msg.Content.URL, msg.Content.MSC3414File)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", bridgev2.ErrMediaDownloadFailed, err)
+	}
+	if err := pc.client.SetGroupPortrait(peerID, pc.client.MediaURI(data, "avatar"+mimetype.Detect(data).Extension())); err != nil {
+		return false, err
+	}
+
+	msg.Portal.AvatarID = networkid.AvatarID(msg.Content.URL)
+	msg.Portal.AvatarHash = sha256.Sum256(data)
+	msg.Portal.AvatarMXC = msg.Content.URL
+	msg.Portal.AvatarSet = true
+
+	return true, nil
+}
+
+func (pc *PylonClient) supportsAction(action onebot.RequestType) bool {
+	return pc.client.GetProfile().SupportsAction(action)
+}
+
+// checkAction rejects Matrix changes the agent can't carry out
+func (pc *PylonClient) checkAction(action onebot.RequestType) error {
+	if !pc.supportsAction(action) {
+		return fmt.Errorf("%s is not supported by the agent", action)
+	}
+	return nil
+}
+
+func (pc *PylonClient) ensureGroupAdmin(groupID string) error {
+	if pl, err := pc.getSelfPowerLevel(groupID); err != nil {
+		return err
+	} else if pl < powerAdmin {
+		return fmt.Errorf("only the group owner and admins can change the group info")
+	}
+	return nil
+}
+
+func (pc *PylonClient) HandleMatrixPowerLevels(ctx context.Context, msg *bridgev2.MatrixPowerLevelChange) (bool, error) {
+	if !pc.IsLoggedIn() {
+		return false, bridgev2.ErrNotLoggedIn
+	}
+
+	peerType, peerID := ids.ParsePortalID(msg.Portal.ID)
+	if peerType != ids.PeerTypeGroup {
+		return false, nil
+	}
+
+	if msg.PrevContent.GetUserLevel(msg.Event.Sender) < powerAdmin {
+		return false, fmt.Errorf("only group admins can change power levels")
+	}
+
+	if msg.EventsDefault != nil {
+		if err := pc.checkAction(onebot.SetGroupWholeBan); err != nil {
+			return false, err
+		}
+		if err := pc.client.SetGroupWholeBan(peerID, msg.EventsDefault.NewLevel > powerDefault); err != nil {
+			return false, err
+		}
+	}
+
+	var selfPowerLevel *int
+	for _, change := range msg.Users {
+		ghost, ok := change.Target.(*bridgev2.Ghost)
+		if !ok {
+			continue
+		}
+
+		origRole, newRole := powerLevelRole(change.OrigLevel), powerLevelRole(change.NewLevel)
+		if origRole == roleOwner || newRole == roleOwner {
+			if origRole != newRole {
+				return false, fmt.Errorf("transferring group ownership is not supported")
+			}
+		} else if origRole != newRole {
+			if selfPowerLevel == nil {
+				pl, err := pc.getSelfPowerLevel(peerID)
+				if err != nil {
+					return false, err
+				}
+				selfPowerLevel = &pl
+			}
+			if *selfPowerLevel < powerSuperAdmin {
+				return false, fmt.Errorf("only the group owner can change admins")
+			}
+			if err := pc.checkAction(onebot.SetGroupAdmin); err != nil {
+				return false, err
+			}
+			if err := pc.client.SetGroupAdmin(peerID, string(ghost.ID), newRole == roleAdmin); err != nil {
+				return false, err
+			}
+		}
+
+		// A demoted admin may be muted in the same change
+		muted := change.NewLevel < powerDefault
+		if muted == (change.OrigLevel < powerDefault) {
+			continue
+		}
+
+		if err := pc.checkAction(onebot.SetGroupBan); err != nil {
+			return false, err
+		}
+		var duration time.Duration
+		if muted {
+			duration = pc.main.Config.MuteDuration
+		}
+		if err := pc.client.SetGroupBan(peerID, string(ghost.ID), duration); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,32 @@
+package connector
+
+import (
+	"testing"
+
+	"maunium.net/go/mautrix/event"
+)
+
+func TestRoomNick(t *testing.T) {
+	tests := []struct {
+		name       string
+		prev, next string
+		global     string
+		want       string
+		wantOK     bool
+	}{
+		{"global rename", "Alice", "Alicia", "Alicia", "", false},
+		{"room nick", "Alice", "Group Alice", "Alice", "Group Alice", true},
+		{"room nick after rename", "Alicia", "Group Alice", "Alicia", "Group Alice", true},
+		{"unchanged", "Group Alice", "Group Alice", "Alice", "", false},
+	}
+	for _, tt := range tests {
+		card, ok := roomNick(
+			&event.MemberEventContent{Displayname: tt.next},
+			&event.MemberEventContent{Displayname: tt.prev},
+			tt.global,
+		)
+		if card != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: roomNick = %q, %v, want %q, %v", tt.name, card, ok, tt.want, tt.wantOK)
+		}
+	}
+}
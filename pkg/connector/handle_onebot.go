@@ -1,16 +1,21 @@
 package connector
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/duo/matrix-pylon/pkg/ids"
 	"github.com/duo/matrix-pylon/pkg/onebot"
 
 	"github.com/rs/zerolog"
+	"go.mau.fi/util/ptr"
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/bridgev2/networkid"
+	"maunium.net/go/mautrix/bridgev2/simplevent"
+	"maunium.net/go/mautrix/event"
 )
 
 func (pc *PylonClient) handleOnebotEvent(evt onebot.IEvent) {
@@ -28,50 +33,467 @@ func (pc *PylonClient) handleOnebotEvent(evt onebot.IEvent) {
 			pc:      pc,
 		})
 	case onebot.NoticeFriendRecall:
-		// TODO: delete message
 		friendRecall := evt.(*onebot.FriendRecall)
-		// TODO: handle self recall event
+		peerID := friendRecall.UserID
 		if friendRecall.SelfID == friendRecall.UserID {
-			return
+			// Self recall only carries our own ID, look up the chat of the message
+			msg, err := pc.client.GetMessage(friendRecall.MessageID)
+			if err != nil {
+				pc.userLogin.Log.Warn().Err(err).Str("message_id", friendRecall.MessageID).Msg("Failed to get recalled message")
+				return
+			}
+			if peerID = msg.TargetID; peerID == "" {
+				pc.userLogin.Log.Warn().Str("message_id", friendRecall.MessageID).Msg("Unknown chat of recalled message")
+				return
+			}
 		}
-		pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &OnebotMessageEvent{
-			message: &onebot.Message{
-				MessageType: "private",
-				MessageID:   friendRecall.MessageID,
-				Sender:      onebot.Sender{UserID: friendRecall.UserID},
-				Event:       onebot.Event{Time: friendRecall.Time},
-				Message: []onebot.ISegment{
-					onebot.NewReply(friendRecall.MessageID),
-					onebot.NewText("[revoke]"),
-				},
-			},
-			pc:     pc,
-			isFake: true,
+		pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &OnebotRecallEvent{
+			peerType:  ids.PeerTypeUser,
+			peerID:    peerID,
+			messageID: friendRecall.MessageID,
+			senderID:  friendRecall.UserID,
+			time:      friendRecall.Time,
+			pc:        pc,
 		})
 	case onebot.NoticeGroupRecall:
-		// TODO: delete message
 		groupRecall := evt.(*onebot.GroupRecall)
-		pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &OnebotMessageEvent{
-			message: &onebot.Message{
-				MessageType: "group",
-				MessageID:   groupRecall.MessageID,
-				GroupID:     groupRecall.GroupID,
-				Sender:      onebot.Sender{UserID: groupRecall.UserID},
-				Event:       onebot.Event{Time: groupRecall.Time},
-				Message: []onebot.ISegment{
-					onebot.NewReply(groupRecall.MessageID),
-					onebot.NewText("[revoke]"),
+		pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &OnebotRecallEvent{
+			peerType:  ids.PeerTypeGroup,
+			peerID:    groupRecall.GroupID,
+			messageID: groupRecall.MessageID,
+			senderID:  operatorOr(groupRecall.OperatorID, groupRecall.UserID),
+			time:      groupRecall.Time,
+			pc:        pc,
+		})
+	case onebot.NoticeGroupIncreaseApprove, onebot.NoticeGroupIncreaseInvite:
+		increase := evt.(*onebot.GroupIncrease)
+		senderID := increase.UserID
+		if increase.EventType() == onebot.NoticeGroupIncreaseInvite {
+			senderID = operatorOr(increase.OperatorID, increase.UserID)
+		}
+		pc.handleGroupMemberChange(increase.GroupID, increase.UserID, senderID, event.MembershipJoin, increase.Time)
+	case onebot.NoticeGroupDecreaseleave, onebot.NoticeGroupDecreaseKick, onebot.NoticeGroupDecreaseKickMe:
+		decrease := evt.(*onebot.GroupDecrease)
+		senderID := decrease.UserID
+		if decrease.EventType() != onebot.NoticeGroupDecreaseleave {
+			senderID = operatorOr(decrease.OperatorID, decrease.UserID)
+		}
+		pc.handleGroupMemberChange(decrease.GroupID, decrease.UserID, senderID, event.MembershipLeave, decrease.Time)
+	case onebot.RequestFriend:
+		pc.handleFriendRequest(context.Background(), evt.(*onebot.FriendRequest))
+	case onebot.RequestGroupAdd, onebot.RequestGroupInvite:
+		pc.handleGroupRequest(context.Background(), evt.(*onebot.GroupRequest))
+	case onebot.NoticeGroupAdminSet, onebot.NoticeGroupAdminUnset:
+		admin := evt.(*onebot.GroupAdmin)
+		role := roleMember
+		if admin.EventType() == onebot.NoticeGroupAdminSet {
+			role = roleAdmin
+		}
+		if admin.UserID == string(pc.userLogin.ID) && pc.setSelfRole(admin.GroupID, role == roleAdmin) {
+			go pc.updateGroupCapabilities(pc.userLogin.Log.WithContext(context.Background()), admin.GroupID)
+		}
+		pl := rolePowerLevel(role)
+		if role == roleMember {
+			pl = pc.demotedPowerLevel(admin.GroupID, admin.UserID)
+		}
+		pc.queueMemberPowerLevel(simplevent.EventMeta{
+			Type: bridgev2.RemoteEventChatInfoChange,
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.Str("user_id", admin.UserID).Str("role", role)
+			},
+			PortalKey: pc.makePortalKey(ids.PeerTypeGroup, admin.GroupID),
+			Timestamp: time.UnixMilli(admin.Time * 1000),
+		}, admin.UserID, pl)
+	case onebot.NoticeGroupBanBan, onebot.NoticeGroupBanLiftBan:
+		pc.handleGroupBan(evt.(*onebot.GroupBan))
+	case onebot.NoticeGroupMsgEmojiLike:
+		pc.handleGroupMsgEmojiLike(evt.(*onebot.GroupMsgEmojiLike))
+	case onebot.NoticeNotifyPoke:
+		pc.handlePoke(evt.(*onebot.Poke))
+	case onebot.NoticeGroupUpload:
+		upload := evt.(*onebot.GroupUpload)
+		pc.queueUploadedFile(ids.PeerTypeGroup, upload.GroupID, upload.UserID, &upload.File, upload.Time)
+	case onebot.NoticeOfflineFile:
+		offline := evt.(*onebot.OfflineFile)
+		pc.queueUploadedFile(ids.PeerTypeUser, offline.UserID, offline.UserID, &offline.File, offline.Time)
+	}
+}
+
+// Uploads made from Matrix are echoed by the agent, this long is allowed for that
+const pendingUploadTTL = 10 * time.Minute
+
+func pendingUploadKey(peerID, name string) string {
+	return peerID + "\u0001" + name
+}
+
+func (pc *PylonClient) addPendingUpload(peerID, name string) {
+	pc.pendingUploadsLock.Lock()
+	defer pc.pendingUploadsLock.Unlock()
+
+	for key, uploadedAt := range pc.pendingUploads {
+		if time.Since(uploadedAt) > pendingUploadTTL {
+			delete(pc.pendingUploads, key)
+		}
+	}
+	pc.pendingUploads[pendingUploadKey(peerID, name)] = time.Now()
+}
+
+// takePendingUpload reports whether the file was uploaded from Matrix, the entry is removed
+func (pc *PylonClient) takePendingUpload(peerID, name string) bool {
+	pc.pendingUploadsLock.Lock()
+	defer pc.pendingUploadsLock.Unlock()
+
+	key := pendingUploadKey(peerID, name)
+	uploadedAt, ok := pc.pendingUploads[key]
+	delete(pc.pendingUploads, key)
+	return ok && time.Since(uploadedAt) <= pendingUploadTTL
+}
+
+func (pc *PylonClient) queueUploadedFile(peerType ids.PeerType, peerID, senderID string, file *onebot.UploadedFile, ts int64) {
+	// The upload notice of a file sent from Matrix, it is already in the room
+	if senderID == string(pc.userLogin.ID) && pc.takePendingUpload(peerID, file.Name) {
+		return
+	}
+
+	pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &simplevent.Message[*onebot.UploadedFile]{
+		EventMeta: simplevent.EventMeta{
+			Type: bridgev2.RemoteEventMessage,
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.Str("file_id", file.ID).Str("file_name", file.Name).Int64("file_size", file.Size)
+			},
+			PortalKey:    pc.makePortalKey(peerType, peerID),
+			Sender:       pc.makeEventSender(senderID),
+			Timestamp:    time.UnixMilli(ts * 1000),
+			CreatePortal: true,
+		},
+		Data: file,
+		ID:   ids.MakeFakeMessageID(peerID, fmt.Sprintf("file-%s-%d", cmp.Or(file.ID, file.Name), ts)),
+		ConvertMessageFunc: func(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, data *onebot.UploadedFile) (*bridgev2.ConvertedMessage, error) {
+			return pc.main.MsgConv.FileToMatrix(ctx, pc.client, portal, intent, data.Segment()), nil
+		},
+	})
+}
+
+func (pc *PylonClient) handlePoke(poke *onebot.Poke) {
+	senderID := poke.Sender()
+
+	var portalKey networkid.PortalKey
+	var peerID string
+	if poke.IsGroup() {
+		peerID = poke.GroupID
+		portalKey = pc.makePortalKey(ids.PeerTypeGroup, peerID)
+	} else {
+		peerID = senderID
+		if ids.MakeUserLoginID(senderID) == pc.userLogin.ID {
+			peerID = poke.TargetID
+		}
+		portalKey = pc.makePortalKey(ids.PeerTypeUser, peerID)
+	}
+
+	pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &simplevent.Message[*onebot.Poke]{
+		EventMeta: simplevent.EventMeta{
+			Type: bridgev2.RemoteEventMessage,
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.Str("sender_id", senderID).Str("target_id", poke.TargetID)
+			},
+			PortalKey: portalKey,
+			Sender:    pc.makeEventSender(senderID),
+			Timestamp: time.UnixMilli(poke.Time * 1000),
+		},
+		Data: poke,
+		ID:   ids.MakeFakeMessageID(peerID, fmt.Sprintf("poke-%s-%s-%d", senderID, poke.TargetID, poke.Time)),
+		ConvertMessageFunc: func(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, data *onebot.Poke) (*bridgev2.ConvertedMessage, error) {
+			return pc.main.MsgConv.PokeToMatrix(ctx, data.TargetID), nil
+		},
+	})
+}
+
+func (pc *PylonClient) handleGroupMsgEmojiLike(like *onebot.GroupMsgEmojiLike) {
+	evtType := bridgev2.RemoteEventReaction
+	if !like.Added() {
+		evtType = bridgev2.RemoteEventReactionRemove
+	}
+
+	for _, l := range like.Likes {
+		pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &simplevent.Reaction{
+			EventMeta: simplevent.EventMeta{
+				Type: evtType,
+				LogContext: func(c zerolog.Context) zerolog.Context {
+					return c.Str("message_id", like.MessageID).Str("emoji_id", l.EmojiID)
 				},
+				PortalKey: pc.makePortalKey(ids.PeerTypeGroup, like.GroupID),
+				Sender:    pc.makeEventSender(like.UserID),
+				Timestamp: time.UnixMilli(like.Time * 1000),
 			},
-			pc:     pc,
-			isFake: true,
+			TargetMessage: ids.MakeMessageID(like.GroupID, like.MessageID),
+			EmojiID:       networkid.EmojiID(l.EmojiID),
+			Emoji:         pc.client.GetProfile().FaceToReaction(l.EmojiID),
 		})
 	}
 }
 
+func (pc *PylonClient) handleGroupMemberChange(groupID, userID, senderID string, membership event.Membership, ts int64) {
+	memberSender := pc.makeEventSender(userID)
+
+	evt := &simplevent.ChatInfoChange{
+		EventMeta: simplevent.EventMeta{
+			Type: bridgev2.RemoteEventChatInfoChange,
+			LogContext: func(c zerolog.Context) zerolog.Context {
+				return c.Str("user_id", userID).Str("sender_id", senderID).Str("membership", string(membership))
+			},
+			PortalKey: pc.makePortalKey(ids.PeerTypeGroup, groupID),
+			Sender:    pc.makeEventSender(senderID),
+			Timestamp: time.UnixMilli(ts * 1000),
+		},
+		ChatInfoChange: &bridgev2.ChatInfoChange{
+			MemberChanges: &bridgev2.ChatMemberList{
+				MemberMap: map[networkid.UserID]bridgev2.ChatMember{
+					memberSender.Sender: {
+						EventSender: memberSender,
+						Membership:  membership,
+					},
+				},
+			},
+		},
+	}
+
+	// The user is no longer in the group, forget the portal for this login
+	if memberSender.IsFromMe && membership == event.MembershipLeave {
+		pc.setSelfRole(groupID, false)
+		evt.PostHandleFunc = func(ctx context.Context, portal *bridgev2.Portal) {
+			up, err := pc.main.Bridge.DB.UserPortal.Get(ctx, pc.userLogin.UserLogin, portal.PortalKey)
+			if err != nil {
+				zerolog.Ctx(ctx).Err(err).Msg("Failed to get user portal")
+			} else if up != nil {
+				if err := pc.main.Bridge.DB.UserPortal.Delete(ctx, up); err != nil {
+					zerolog.Ctx(ctx).Err(err).Msg("Failed to delete user portal")
+				}
+			}
+		}
+	}
+
+	pc.main.Bridge.QueueRemoteEvent(pc.userLogin, evt)
+}
+
+func (pc *PylonClient) handleGroupBan(ban *onebot.GroupBan) {
+	isBan := ban.EventType() == onebot.NoticeGroupBanBan
+	portalKey := pc.makePortalKey(ids.PeerTypeGroup, ban.GroupID)
+	// Expired mutes are lifted by the system, which the bridge bot stands in for
+	senderID := operatorOr(ban.OperatorID, "")
+	meta := simplevent.EventMeta{
+		Type: bridgev2.RemoteEventChatInfoChange,
+		LogContext: func(c zerolog.Context) zerolog.Context {
+			return c.Str("user_id", ban.UserID).Str("sender_id", senderID).Bool("ban", isBan)
+		},
+		PortalKey: portalKey,
+		Sender:    pc.makeEventSender(senderID),
+		Timestamp: time.UnixMilli(ban.Time * 1000),
+	}
+
+	if ban.IsWholeBan() {
+		eventsDefault := powerDefault
+		if isBan {
+			eventsDefault = powerAdmin
+		}
+		pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &simplevent.ChatInfoChange{
+			EventMeta: meta,
+			ChatInfoChange: &bridgev2.ChatInfoChange{
+				MemberChanges: &bridgev2.ChatMemberList{
+					PowerLevels: &bridgev2.PowerLevelOverrides{
+						EventsDefault: ptr.Ptr(eventsDefault),
+					},
+				},
+			},
+		})
+		return
+	}
+
+	duration := time.Duration(ban.Duration) * time.Second
+	if isBan {
+		pc.queueMemberPowerLevel(meta, ban.UserID, powerMuted)
+		pc.scheduleUnmute(meta, ban.GroupID, ban.UserID, duration)
+	} else {
+		pc.stopUnmute(ban.GroupID, ban.UserID)
+		pc.restoreMemberPowerLevel(meta, ban.GroupID, ban.UserID)
+	}
+
+	pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &simplevent.Message[*onebot.GroupBan]{
+		EventMeta: meta.WithType(bridgev2.RemoteEventMessage),
+		Data:      ban,
+		ID:        ids.MakeFakeMessageID(ban.GroupID, fmt.Sprintf("ban-%s-%d", ban.UserID, ban.Time)),
+		ConvertMessageFunc: func(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI, data *onebot.GroupBan) (*bridgev2.ConvertedMessage, error) {
+			name := data.UserID
+			if ghost, err := pc.main.Bridge.GetGhostByID(ctx, ids.MakeUserID(data.UserID)); err == nil && ghost.Name != "" {
+				name = ghost.Name
+			}
+			body := fmt.Sprintf("unmuted %s", name)
+			if isBan {
+				body = fmt.Sprintf("muted %s for %s", name, formatDuration(duration))
+			}
+			return &bridgev2.ConvertedMessage{
+				Parts: []*bridgev2.ConvertedMessagePart{{
+					Type: event.EventMessage,
+					Content: &event.MessageEventContent{
+						MsgType: event.MsgNotice,
+						Body:    body,
+					},
+				}},
+			}, nil
+		},
+	})
+}
+
+func muteKey(groupID, userID string) string {
+	return groupID + "\u0001" + userID
+}
+
+// scheduleUnmute lifts the mute in Matrix when it expires, as the agent doesn't notify about that.
+// Timers don't survive restarts, the portal resync picks up expired mutes from the member list then.
+func (pc *PylonClient) scheduleUnmute(meta simplevent.EventMeta, groupID, userID string, duration time.Duration) {
+	pc.muteTimersLock.Lock()
+	defer pc.muteTimersLock.Unlock()
+
+	key := muteKey(groupID, userID)
+	if timer, ok := pc.muteTimers[key]; ok {
+		timer.Stop()
+		delete(pc.muteTimers, key)
+	}
+	if duration <= 0 {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		pc.muteTimersLock.Lock()
+		if pc.muteTimers[key] != timer {
+			pc.muteTimersLock.Unlock()
+			return
+		}
+		delete(pc.muteTimers, key)
+		pc.muteTimersLock.Unlock()
+
+		pc.restoreMemberPowerLevel(meta.WithSender(bridgev2.EventSender{}).WithTimestamp(time.Time{}), groupID, userID)
+	})
+	pc.muteTimers[key] = timer
+}
+
+func (pc *PylonClient) stopUnmute(groupID, userID string) {
+	pc.muteTimersLock.Lock()
+	defer pc.muteTimersLock.Unlock()
+
+	key := muteKey(groupID, userID)
+	if timer, ok := pc.muteTimers[key]; ok {
+		timer.Stop()
+		delete(pc.muteTimers, key)
+	}
+}
+
+func (pc *PylonClient) hasUnmute(groupID, userID string) bool {
+	pc.muteTimersLock.Lock()
+	defer pc.muteTimersLock.Unlock()
+
+	_, ok := pc.muteTimers[muteKey(groupID, userID)]
+	return ok
+}
+
+func (pc *PylonClient) stopAllUnmutes() {
+	pc.muteTimersLock.Lock()
+	defer pc.muteTimersLock.Unlock()
+
+	for key, timer := range pc.muteTimers {
+		timer.Stop()
+		delete(pc.muteTimers, key)
+	}
+}
+
+// restoreMemberPowerLevel sets the power level of an unmuted member back to the one of their role
+func (pc *PylonClient) restoreMemberPowerLevel(meta simplevent.EventMeta, groupID, userID string) {
+	if !pc.IsLoggedIn() {
+		return
+	}
+
+	pl := powerDefault
+	if member, err := pc.client.GetGroupMemberInfo(groupID, userID); err != nil {
+		pc.userLogin.Log.Warn().Err(err).Str("group_id", groupID).Str("user_id", userID).Msg("Failed to get member role after unmute")
+	} else {
+		pl = rolePowerLevel(member.Role)
+	}
+	pc.queueMemberPowerLevel(meta, userID, pl)
+}
+
+// demotedPowerLevel returns the power level of a member who lost admin, who stays muted if they were muted as admin
+func (pc *PylonClient) demotedPowerLevel(groupID, userID string) int {
+	if pc.hasUnmute(groupID, userID) {
+		return powerMuted
+	}
+
+	member, err := pc.client.GetGroupMemberInfo(groupID, userID)
+	if err != nil {
+		pc.userLogin.Log.Warn().Err(err).Str("group_id", groupID).Str("user_id", userID).Msg("Failed to get member mute after demotion")
+		return powerDefault
+	}
+	// The agent may still report the old role right after the notice
+	member.Role = roleMember
+	return memberPowerLevel(member)
+}
+
+// formatDuration renders a mute duration like "1 day 2 hours"
+func formatDuration(d time.Duration) string {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+
+	var parts []string
+	for _, unit := range units {
+		if n := d / unit.size; n > 0 {
+			d -= n * unit.size
+			if n == 1 {
+				parts = append(parts, fmt.Sprintf("1 %s", unit.name))
+			} else {
+				parts = append(parts, fmt.Sprintf("%d %ss", n, unit.name))
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return "0 seconds"
+	}
+	return strings.Join(parts, " ")
+}
+
+func (pc *PylonClient) queueMemberPowerLevel(meta simplevent.EventMeta, userID string, pl int) {
+	memberSender := pc.makeEventSender(userID)
+	pc.main.Bridge.QueueRemoteEvent(pc.userLogin, &simplevent.ChatInfoChange{
+		EventMeta: meta,
+		ChatInfoChange: &bridgev2.ChatInfoChange{
+			MemberChanges: &bridgev2.ChatMemberList{
+				MemberMap: map[networkid.UserID]bridgev2.ChatMember{
+					memberSender.Sender: {
+						EventSender: memberSender,
+						Membership:  event.MembershipJoin,
+						PowerLevel:  &pl,
+					},
+				},
+			},
+		},
+	})
+}
+
+// Some agents report operator_id as 0 if the user acted on their own
+func operatorOr(operatorID, userID string) string {
+	if operatorID == "" || operatorID == "0" {
+		return userID
+	}
+	return operatorID
+}
+
 type OnebotMessageEvent struct {
 	message *onebot.Message
-	isFake  bool
 
 	pc         *PylonClient
 	postHandle func()
@@ -82,7 +504,6 @@ var (
 	_ bridgev2.RemoteChatResyncWithInfo       = (*OnebotMessageEvent)(nil)
 	_ bridgev2.RemoteMessage                  = (*OnebotMessageEvent)(nil)
 	_ bridgev2.RemoteEventWithTimestamp       = (*OnebotMessageEvent)(nil)
-	_ bridgev2.RemoteMessageRemove            = (*OnebotMessageEvent)(nil)
 	_ bridgev2.RemotePostHandler              = (*OnebotMessageEvent)(nil)
 )
 
@@ -107,11 +528,7 @@ func (evt *OnebotMessageEvent) GetSender() bridgev2.EventSender {
 }
 
 func (evt *OnebotMessageEvent) GetID() networkid.MessageID {
-	peerID := ids.GetPeerID(evt.message)
-	if evt.isFake {
-		return ids.MakeFakeMessageID(peerID, fmt.Sprintf("fake-%s", evt.message.MessageID))
-	}
-	return ids.MakeMessageID(peerID, evt.message.MessageID)
+	return ids.MakeMessageID(ids.GetPeerID(evt.message), evt.message.MessageID)
 }
 
 func (evt *OnebotMessageEvent) GetTimestamp() time.Time {
@@ -119,14 +536,9 @@ func (evt *OnebotMessageEvent) GetTimestamp() time.Time {
 }
 
 func (evt *OnebotMessageEvent) GetType() bridgev2.RemoteEventType {
-	// TODO:  bridgev2.RemoteEventMessageRemove
 	return bridgev2.RemoteEventMessage
 }
 
-func (evt *OnebotMessageEvent) GetTargetMessage() networkid.MessageID {
-	return ids.MakeMessageID(ids.GetPeerID(evt.message), evt.message.MessageID)
-}
-
 func (evt *OnebotMessageEvent) GetChatInfo(ctx context.Context, portal *bridgev2.Portal) (*bridgev2.ChatInfo, error) {
 	if evt.message.EventType() == onebot.MessagePrivate {
 		return evt.pc.getDirectChatInfo(string(portal.ID))
@@ -152,3 +564,42 @@ func (evt *OnebotMessageEvent) ConvertMessage(ctx context.Context, portal *bridg
 
 	return evt.pc.main.MsgConv.OnebotToMatrix(ctx, evt.pc.client, portal, intent, evt.message), nil
 }
+
+type OnebotRecallEvent struct {
+	peerType  ids.PeerType
+	peerID    string
+	messageID string
+	senderID  string
+	time      int64
+
+	pc *PylonClient
+}
+
+var (
+	_ bridgev2.RemoteMessageRemove      = (*OnebotRecallEvent)(nil)
+	_ bridgev2.RemoteEventWithTimestamp = (*OnebotRecallEvent)(nil)
+)
+
+func (evt *OnebotRecallEvent) AddLogContext(c zerolog.Context) zerolog.Context {
+	return c.Str("message_id", evt.messageID).Str("sender_id", evt.senderID)
+}
+
+func (evt *OnebotRecallEvent) GetPortalKey() networkid.PortalKey {
+	return evt.pc.makePortalKey(evt.peerType, evt.peerID)
+}
+
+func (evt *OnebotRecallEvent) GetSender() bridgev2.EventSender {
+	return evt.pc.makeEventSender(evt.senderID)
+}
+
+func (evt *OnebotRecallEvent) GetTimestamp() time.Time {
+	return time.UnixMilli(evt.time * 1000)
+}
+
+func (evt *OnebotRecallEvent) GetType() bridgev2.RemoteEventType {
+	return bridgev2.RemoteEventMessageRemove
+}
+
+func (evt *OnebotRecallEvent) GetTargetMessage() networkid.MessageID {
+	return ids.MakeMessageID(evt.peerID, evt.messageID)
+}
@@ -15,12 +15,19 @@ import (
 )
 
 const (
-	LoginFlowIDToken = "token"
+	LoginFlowIDToken     = "token"
+	LoginFlowIDForwardWS = "forward_ws"
+	LoginFlowIDHTTP      = "http"
+	LoginFlowIDSatori    = "satori"
 
 	LoginStepToken    = "me.lxduo.pylon.login.token"
+	LoginStepEndpoint = "me.lxduo.pylon.login.endpoint"
 	LoginStepComplete = "me.lxduo.pylon.login.complete"
 )
 
+// How long to wait for an agent the bridge connects to before giving up
+const agentLoginTimeout = 30 * time.Second
+
 type TokenLogin struct {
 	user   *bridgev2.User
 	main   *PylonConnector
@@ -30,6 +37,17 @@ type TokenLogin struct {
 
 var _ bridgev2.LoginProcessDisplayAndWait = (*TokenLogin)(nil)
 
+// AgentLogin connects the bridge to the forward WebSocket or HTTP API of the agent, or to a Satori server
+type AgentLogin struct {
+	user     *bridgev2.User
+	main     *PylonConnector
+	protocol string
+	mode     onebot.TransportMode
+	log      zerolog.Logger
+}
+
+var _ bridgev2.LoginProcessUserInput = (*AgentLogin)(nil)
+
 func (pc *PylonConnector) GetLoginFlows() []bridgev2.LoginFlow {
 	return []bridgev2.LoginFlow{
 		{
@@ -37,11 +55,50 @@ func (pc *PylonConnector) GetLoginFlows() []bridgev2.LoginFlow {
 			Description: "Use this token to connect the bridge to yourt account",
 			ID:          LoginFlowIDToken,
 		},
+		{
+			Name:        "Forward WebSocket",
+			Description: "Connect the bridge to the WebSocket server of the agent",
+			ID:          LoginFlowIDForwardWS,
+		},
+		{
+			Name:        "HTTP",
+			Description: "Use the HTTP API of the agent, with events posted to the bridge",
+			ID:          LoginFlowIDHTTP,
+		},
+		{
+			Name:        "Satori",
+			Description: "Connect the bridge to a Satori server",
+			ID:          LoginFlowIDSatori,
+		},
 	}
 }
 
 func (pc *PylonConnector) CreateLogin(ctx context.Context, user *bridgev2.User, flowID string) (bridgev2.LoginProcess, error) {
-	if flowID != LoginFlowIDToken {
+	switch flowID {
+	case LoginFlowIDToken:
+	case LoginFlowIDForwardWS, LoginFlowIDHTTP:
+		return &AgentLogin{
+			user: user,
+			main: pc,
+			mode: onebot.TransportMode(flowID),
+			log: user.Log.With().
+				Str("action", "login").
+				Str("transport", flowID).
+				Stringer("user_id", user.MXID).
+				Logger(),
+		}, nil
+	case LoginFlowIDSatori:
+		return &AgentLogin{
+			user:     user,
+			main:     pc,
+			protocol: ProtocolSatori,
+			log: user.Log.With().
+				Str("action", "login").
+				Str("protocol", ProtocolSatori).
+				Stringer("user_id", user.MXID).
+				Logger(),
+		}, nil
+	default:
 		return nil, fmt.Errorf("invalid flow ID %s", flowID)
 	}
 
@@ -122,3 +179,103 @@ func (tl *TokenLogin) Wait(ctx context.Context) (*bridgev2.LoginStep, error) {
 		}
 	}
 }
+
+func (al *AgentLogin) Cancel() {}
+
+func (al *AgentLogin) Start(ctx context.Context) (*bridgev2.LoginStep, error) {
+	instructions := "Enter the WebSocket URL of the agent (e.g. ws://127.0.0.1:3001) and its access token"
+	if al.protocol == ProtocolSatori {
+		instructions = "Enter the URL of the Satori server (e.g. http://127.0.0.1:5500) and its token, if any"
+	} else if al.mode == onebot.TransportHTTP {
+		instructions = "Enter the HTTP API URL of the agent (e.g. http://127.0.0.1:3000) and its access token. " +
+			"Configure the agent to post events to /webhook on the bridge with the same token."
+	}
+
+	return &bridgev2.LoginStep{
+		Type:         bridgev2.LoginStepTypeUserInput,
+		StepID:       LoginStepEndpoint,
+		Instructions: instructions,
+		UserInputParams: &bridgev2.LoginUserInputParams{
+			Fields: []bridgev2.LoginInputDataField{
+				{
+					Type: bridgev2.LoginInputFieldTypeURL,
+					ID:   "endpoint",
+					Name: "Agent URL",
+				},
+				{
+					Type: bridgev2.LoginInputFieldTypeToken,
+					ID:   "token",
+					Name: "Access token",
+				},
+			},
+		},
+	}, nil
+}
+
+// probeAgent connects to the agent with a temporary client to find out which account it's logged into
+func (al *AgentLogin) probeAgent(ctx context.Context, metadata *UserLoginMetadata) (*onebot.UserInfo, error) {
+	client := al.main.newNetworkClient(al.log, "", metadata)
+	defer client.Release()
+	client.Start(al.mode, metadata.Endpoint)
+
+	ctx, cancel := context.WithTimeout(ctx, agentLoginTimeout)
+	defer cancel()
+
+	for {
+		if client.IsLoggedIn() || al.mode == onebot.TransportHTTP {
+			if info, _ := client.GetLoginInfo(); info != nil {
+				return info, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to connect to the agent at %s", metadata.Endpoint)
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+func (al *AgentLogin) SubmitUserInput(ctx context.Context, input map[string]string) (*bridgev2.LoginStep, error) {
+	endpoint, token := input["endpoint"], input["token"]
+	if endpoint == "" {
+		return nil, fmt.Errorf("agent URL is required")
+	} else if token == "" && al.protocol != ProtocolSatori {
+		// The token identifies the login in the service
+		return nil, fmt.Errorf("access token is required")
+	}
+
+	metadata := &UserLoginMetadata{
+		Token:     token,
+		Protocol:  al.protocol,
+		Transport: string(al.mode),
+		Endpoint:  endpoint,
+	}
+	info, err := al.probeAgent(ctx, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	ul, err := al.user.NewLogin(ctx, &database.UserLogin{
+		ID:         ids.MakeUserLoginID(info.ID),
+		RemoteName: info.Nickname,
+		Metadata:   metadata,
+	}, &bridgev2.NewLoginParams{
+		DeleteOnConflict: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user login: %w", err)
+	}
+
+	ul.Client.Connect(ul.Log.WithContext(context.Background()))
+
+	return &bridgev2.LoginStep{
+		Type:         bridgev2.LoginStepTypeComplete,
+		StepID:       LoginStepComplete,
+		Instructions: fmt.Sprintf("Successfully logged in as %s", ul.RemoteName),
+		CompleteParams: &bridgev2.LoginCompleteParams{
+			UserLoginID: ul.ID,
+			UserLogin:   ul,
+		},
+	}, nil
+}
@@ -5,8 +5,25 @@ import (
 	"maunium.net/go/mautrix/bridgev2/database"
 )
 
+const ProtocolSatori = "satori"
+
 type UserLoginMetadata struct {
 	Token string `json:"token"`
+	// The network backend, OneBot if empty
+	Protocol string `json:"protocol,omitempty"`
+	// How the bridge talks to the agent, reverse WebSocket if empty
+	Transport string `json:"transport,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+
+	// Friend and group requests waiting for approve or reject, by flag
+	PendingRequests map[string]*PendingRequest `json:"pending_requests,omitempty"`
+}
+
+type PendingRequest struct {
+	// friend or group
+	Kind       string        `json:"kind"`
+	SubType    string        `json:"sub_type,omitempty"`
+	ReceivedAt jsontime.Unix `json:"received_at"`
 }
 
 type GhostMetadata struct {
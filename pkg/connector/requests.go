@@ -0,0 +1,130 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/duo/matrix-pylon/pkg/onebot"
+
+	"go.mau.fi/util/jsontime"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+// Flags expire on the QQ side, requests older than this are forgotten
+const pendingRequestTTL = 7 * 24 * time.Hour
+
+const (
+	requestKindFriend = "friend"
+	requestKindGroup  = "group"
+)
+
+func (pc *PylonClient) handleFriendRequest(ctx context.Context, req *onebot.FriendRequest) {
+	pc.addPendingRequest(ctx, req.Flag, &PendingRequest{Kind: requestKindFriend})
+
+	text := fmt.Sprintf("%s wants to add you as a friend.", pc.describeUser(req.UserID))
+	pc.sendRequestNotice(ctx, text, req.Comment, req.Flag)
+}
+
+func (pc *PylonClient) handleGroupRequest(ctx context.Context, req *onebot.GroupRequest) {
+	pc.addPendingRequest(ctx, req.Flag, &PendingRequest{Kind: requestKindGroup, SubType: req.SubType})
+
+	var text string
+	if req.EventType() == onebot.RequestGroupInvite {
+		text = fmt.Sprintf("%s invited you to join %s.", pc.describeUser(req.UserID), pc.describeGroup(req.GroupID))
+	} else {
+		text = fmt.Sprintf("%s wants to join %s.", pc.describeUser(req.UserID), pc.describeGroup(req.GroupID))
+	}
+	pc.sendRequestNotice(ctx, text, req.Comment, req.Flag)
+}
+
+func (pc *PylonClient) sendRequestNotice(ctx context.Context, text, comment, flag string) {
+	log := pc.userLogin.Log
+
+	roomID, err := pc.userLogin.User.GetManagementRoom(ctx)
+	if err != nil {
+		log.Err(err).Msg("Failed to get management room")
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(text)
+	if comment != "" {
+		fmt.Fprintf(&sb, "\n\n> %s", comment)
+	}
+	fmt.Fprintf(&sb, "\n\nUse `approve %s` or `reject %s [reason]` to respond.", flag, flag)
+
+	content := format.RenderMarkdown(sb.String(), true, false)
+	content.MsgType = event.MsgNotice
+	if _, err := pc.main.Bridge.Bot.SendMessage(ctx, roomID, event.EventMessage, &event.Content{Parsed: &content}, nil); err != nil {
+		log.Err(err).Str("flag", flag).Msg("Failed to send request notice")
+	}
+}
+
+func (pc *PylonClient) respondRequest(flag string, req *PendingRequest, approve bool, reason string) error {
+	if req.Kind == requestKindFriend {
+		return pc.client.SetFriendAddRequest(flag, approve)
+	}
+	return pc.client.SetGroupAddRequest(flag, req.SubType, approve, reason)
+}
+
+// addPendingRequest stores the request in the login metadata, so that it can be answered after a restart
+func (pc *PylonClient) addPendingRequest(ctx context.Context, flag string, req *PendingRequest) {
+	pc.pendingRequestsLock.Lock()
+	defer pc.pendingRequestsLock.Unlock()
+
+	meta := pc.userLogin.Metadata.(*UserLoginMetadata)
+	if meta.PendingRequests == nil {
+		meta.PendingRequests = make(map[string]*PendingRequest)
+	}
+	for key, pending := range meta.PendingRequests {
+		if time.Since(pending.ReceivedAt.Time) > pendingRequestTTL {
+			delete(meta.PendingRequests, key)
+		}
+	}
+	req.ReceivedAt = jsontime.UnixNow()
+	meta.PendingRequests[flag] = req
+
+	pc.saveLogin(ctx)
+}
+
+func (pc *PylonClient) getPendingRequest(flag string) *PendingRequest {
+	pc.pendingRequestsLock.Lock()
+	defer pc.pendingRequestsLock.Unlock()
+
+	req := pc.userLogin.Metadata.(*UserLoginMetadata).PendingRequests[flag]
+	if req == nil || time.Since(req.ReceivedAt.Time) > pendingRequestTTL {
+		return nil
+	}
+	return req
+}
+
+func (pc *PylonClient) removePendingRequest(ctx context.Context, flag string) {
+	pc.pendingRequestsLock.Lock()
+	defer pc.pendingRequestsLock.Unlock()
+
+	delete(pc.userLogin.Metadata.(*UserLoginMetadata).PendingRequests, flag)
+	pc.saveLogin(ctx)
+}
+
+func (pc *PylonClient) saveLogin(ctx context.Context) {
+	if err := pc.userLogin.Save(ctx); err != nil {
+		pc.userLogin.Log.Err(err).Msg("Failed to save login metadata")
+	}
+}
+
+func (pc *PylonClient) describeUser(userID string) string {
+	if info, err := pc.client.GetUserInfo(userID); err == nil && info.Nickname != "" {
+		return fmt.Sprintf("**%s** (%s)", info.Nickname, userID)
+	}
+	return userID
+}
+
+func (pc *PylonClient) describeGroup(groupID string) string {
+	if info, err := pc.client.GetGroupInfo(groupID); err == nil && info.Name != "" {
+		return fmt.Sprintf("**%s** (%s)", info.Name, groupID)
+	}
+	return groupID
+}
@@ -1,11 +1,14 @@
 package msgconv
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"html"
 	"math"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,7 +27,7 @@ import (
 
 func (mc *MessageConverter) OnebotToMatrix(
 	ctx context.Context,
-	client *onebot.Client,
+	client onebot.API,
 	portal *bridgev2.Portal,
 	intent bridgev2.MatrixAPI,
 	msg *onebot.Message,
@@ -36,8 +39,9 @@ func (mc *MessageConverter) OnebotToMatrix(
 	cm := &bridgev2.ConvertedMessage{}
 
 	var part *bridgev2.ConvertedMessagePart
+	var attachments []*bridgev2.ConvertedMessagePart
 
-	mediaParts := make([]*bridgev2.ConvertedMessagePart, 0)
+	var mediaSegments []onebot.ISegment
 	mentions := make([]string, 0)
 
 	var contentBuilder strings.Builder
@@ -46,9 +50,9 @@ func (mc *MessageConverter) OnebotToMatrix(
 	for _, s := range segments {
 		switch v := s.(type) {
 		case *onebot.TextSegment:
-			fmt.Fprint(&contentBuilder, convertOnebotEmoji(client, v.Content()))
+			fmt.Fprint(&contentBuilder, client.GetProfile().ConvertText(v.Content()))
 		case *onebot.FaceSegment:
-			fmt.Fprint(&contentBuilder, convertOnebotFace(client, v.ID()))
+			fmt.Fprint(&contentBuilder, client.GetProfile().FaceText(v.ID()))
 		case *onebot.AtSegment:
 			target := v.Target()
 			if target == "all" {
@@ -57,26 +61,26 @@ func (mc *MessageConverter) OnebotToMatrix(
 			fmt.Fprintf(&contentBuilder, "@%s", target)
 			mentions = append(mentions, target)
 		case *onebot.ImageSegment:
-			mediaParts = append(mediaParts, mc.convertMediaMessage(ctx, v))
+			mediaSegments = append(mediaSegments, v)
 			fmt.Fprint(&contentBuilder, "[Image]")
 		case *onebot.MarketFaceSegment:
-			mediaParts = append(mediaParts, mc.convertMediaMessage(ctx, v))
+			mediaSegments = append(mediaSegments, v)
 			fmt.Fprint(&contentBuilder, "[Image]")
 		case *onebot.RecordSegment:
-			mediaParts = append(mediaParts, mc.convertMediaMessage(ctx, v))
+			mediaSegments = append(mediaSegments, v)
 			fmt.Fprint(&contentBuilder, "[Voice]")
 		case *onebot.VideoSegment:
-			mediaParts = append(mediaParts, mc.convertMediaMessage(ctx, v))
+			mediaSegments = append(mediaSegments, v)
 			fmt.Fprint(&contentBuilder, "[Video]")
 		case *onebot.FileSegment:
-			mediaParts = append(mediaParts, mc.convertMediaMessage(ctx, v))
+			mediaSegments = append(mediaSegments, v)
 			fmt.Fprint(&contentBuilder, "[File]")
 		case *onebot.ReplySegment:
 			cm.ReplyTo = &networkid.MessageOptionalPartID{
 				MessageID: ids.MakeMessageID(ids.GetPeerID(msg), v.ID()),
 			}
 		case *onebot.ForwardSegment:
-			fmt.Fprint(&contentBuilder, "[Chat History]")
+			part, attachments = mc.convertForwardMessage(ctx, v)
 		case *onebot.ShareSegment:
 			part = mc.convertShareMessage(v.Title(), v.Content(), v.URL())
 		case *onebot.JSONSegment:
@@ -86,6 +90,8 @@ func (mc *MessageConverter) OnebotToMatrix(
 		}
 	}
 
+	mediaParts := mc.convertMediaMessages(ctx, mediaSegments)
+
 	if part == nil {
 		if len(segments) > 1 && len(mediaParts) >= 1 { // mixed image and text
 			var imagesMarkdown strings.Builder
@@ -122,10 +128,204 @@ func (mc *MessageConverter) OnebotToMatrix(
 	mc.addMentions(ctx, mentions, part.Content)
 
 	cm.Parts = []*bridgev2.ConvertedMessagePart{part}
+	for i, attachment := range attachments {
+		attachment.ID = networkid.PartID(strconv.Itoa(i + 1))
+		cm.Parts = append(cm.Parts, attachment)
+	}
 
 	return cm
 }
 
+// Limits how many levels of nested chat history get expanded
+const maxForwardDepth = 3
+
+func (mc *MessageConverter) convertForwardMessage(ctx context.Context, seg *onebot.ForwardSegment) (*bridgev2.ConvertedMessagePart, []*bridgev2.ConvertedMessagePart) {
+	var body, formatted strings.Builder
+	var attachments []*bridgev2.ConvertedMessagePart
+
+	fmt.Fprint(&body, "[Chat History]\n")
+	fmt.Fprint(&formatted, "<p>[Chat History]</p>")
+	mc.renderForward(ctx, seg, 1, &body, &formatted, &attachments)
+
+	return &bridgev2.ConvertedMessagePart{
+		Type: event.EventMessage,
+		Content: &event.MessageEventContent{
+			MsgType:       event.MsgText,
+			Format:        event.FormatHTML,
+			Body:          strings.TrimSuffix(body.String(), "\n"),
+			FormattedBody: formatted.String(),
+		},
+	}, attachments
+}
+
+func (mc *MessageConverter) renderForward(
+	ctx context.Context,
+	seg *onebot.ForwardSegment,
+	depth int,
+	body, formatted *strings.Builder,
+	attachments *[]*bridgev2.ConvertedMessagePart,
+) {
+	log := zerolog.Ctx(ctx)
+	prefix := strings.Repeat("> ", depth)
+
+	messages := seg.Messages()
+	if len(messages) == 0 {
+		if seg.ID() == "" {
+			fmt.Fprintf(body, "%s[Chat History]\n", prefix)
+			fmt.Fprint(formatted, "<blockquote>[Chat History]</blockquote>")
+			return
+		}
+
+		var err error
+		if messages, err = getClient(ctx).GetForwardMessage(seg.ID()); err != nil {
+			log.Err(err).Str("forward_id", seg.ID()).Msg("Failed to get forward message")
+			fmt.Fprintf(body, "%s[Chat History]\n", prefix)
+			fmt.Fprint(formatted, "<blockquote>[Chat History]</blockquote>")
+			return
+		}
+	}
+
+	fmt.Fprint(formatted, "<blockquote>")
+	for _, msg := range messages {
+		name := cmp.Or(msg.Sender.Card, msg.Sender.Nickname, msg.Sender.UserID, msg.UserID)
+		ts := time.UnixMilli(msg.Time * 1000).Format(time.DateTime)
+
+		fmt.Fprintf(body, "%s%s (%s):\n", prefix, name, ts)
+		fmt.Fprintf(formatted, "<p><strong>%s</strong> <small>%s</small><br>", html.EscapeString(name), ts)
+
+		// Nested history is a sibling of the paragraphs around it, which are reopened after it
+		inParagraph := true
+		writeHTML := func(s string) {
+			if !inParagraph {
+				fmt.Fprint(formatted, "<p>")
+				inParagraph = true
+			}
+			fmt.Fprint(formatted, s)
+		}
+
+		var text strings.Builder
+		segments, _ := msg.Message.([]onebot.ISegment)
+		for _, s := range segments {
+			switch v := s.(type) {
+			case *onebot.TextSegment:
+				content := getClient(ctx).GetProfile().ConvertText(v.Content())
+				fmt.Fprint(&text, content)
+				writeHTML(strings.ReplaceAll(html.EscapeString(content), "\n", "<br>"))
+			case *onebot.FaceSegment:
+				face := getClient(ctx).GetProfile().FaceText(v.ID())
+				fmt.Fprint(&text, face)
+				writeHTML(html.EscapeString(face))
+			case *onebot.AtSegment:
+				fmt.Fprintf(&text, "@%s", v.Target())
+				writeHTML("@" + html.EscapeString(v.Target()))
+			case *onebot.ImageSegment, *onebot.MarketFaceSegment:
+				fmt.Fprint(&text, "[Image]")
+				if part, err := mc.reploadAttachment(ctx, v); err != nil {
+					log.Err(err).Msg("Failed to reupload forwarded image")
+					writeHTML("[Image]")
+				} else if part.Content.File != nil {
+					// Encrypted media can't be inlined, so it is sent after the history like other attachments
+					writeHTML("[Image]")
+					*attachments = append(*attachments, part)
+				} else {
+					writeHTML(fmt.Sprintf(`<img src="%s" alt="%s">`, part.Content.URL, html.EscapeString(part.Content.FileName)))
+				}
+			case *onebot.RecordSegment, *onebot.VideoSegment, *onebot.FileSegment:
+				label := mediaLabel(v)
+				fmt.Fprint(&text, label)
+				writeHTML(label)
+				*attachments = append(*attachments, mc.convertMediaMessage(ctx, v))
+			case *onebot.ForwardSegment:
+				if depth < maxForwardDepth {
+					if text.Len() > 0 {
+						writeQuotedLines(body, prefix, text.String())
+						text.Reset()
+					}
+					if inParagraph {
+						fmt.Fprint(formatted, "</p>")
+						inParagraph = false
+					}
+					mc.renderForward(ctx, v, depth+1, body, formatted, attachments)
+				} else {
+					fmt.Fprint(&text, "[Chat History]")
+					writeHTML("[Chat History]")
+				}
+			case *onebot.ReplySegment:
+				// Replies can't be resolved outside of the original chat
+			default:
+				fmt.Fprintf(&text, "[%s]", v.SegmentType())
+				writeHTML(fmt.Sprintf("[%s]", html.EscapeString(string(v.SegmentType()))))
+			}
+		}
+		if text.Len() > 0 {
+			writeQuotedLines(body, prefix, text.String())
+		}
+		if inParagraph {
+			fmt.Fprint(formatted, "</p>")
+		}
+	}
+	fmt.Fprint(formatted, "</blockquote>")
+}
+
+func writeQuotedLines(b *strings.Builder, prefix, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(b, "%s%s\n", prefix, line)
+	}
+}
+
+func mediaLabel(seg onebot.ISegment) string {
+	switch seg.(type) {
+	case *onebot.RecordSegment:
+		return "[Voice]"
+	case *onebot.VideoSegment:
+		return "[Video]"
+	case *onebot.FileSegment:
+		return "[File]"
+	default:
+		return "[Image]"
+	}
+}
+
+func (mc *MessageConverter) FileToMatrix(
+	ctx context.Context,
+	client onebot.API,
+	portal *bridgev2.Portal,
+	intent bridgev2.MatrixAPI,
+	seg *onebot.FileSegment,
+) *bridgev2.ConvertedMessage {
+	ctx = context.WithValue(ctx, contextKeyClient, client)
+	ctx = context.WithValue(ctx, contextKeyIntent, intent)
+	ctx = context.WithValue(ctx, contextKeyPortal, portal)
+
+	return &bridgev2.ConvertedMessage{
+		Parts: []*bridgev2.ConvertedMessagePart{mc.convertMediaMessage(ctx, seg)},
+	}
+}
+
+func (mc *MessageConverter) PokeToMatrix(ctx context.Context, targetID string) *bridgev2.ConvertedMessage {
+	content := &event.MessageEventContent{
+		MsgType:  event.MsgEmote,
+		Body:     fmt.Sprintf("poked %s", targetID),
+		Mentions: &event.Mentions{},
+	}
+
+	if mxid, displayname, err := mc.getBasicUserInfo(ctx, ids.MakeUserID(targetID)); err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("id", targetID).Msg("Failed to get user info")
+	} else {
+		content.Body = fmt.Sprintf("poked %s", displayname)
+		content.Format = event.FormatHTML
+		content.FormattedBody = fmt.Sprintf(`poked <a href="%s">%s</a>`, mxid.URI().MatrixToURL(), html.EscapeString(displayname))
+		content.Mentions.UserIDs = []id.UserID{mxid}
+	}
+
+	return &bridgev2.ConvertedMessage{
+		Parts: []*bridgev2.ConvertedMessagePart{{
+			Type:    event.EventMessage,
+			Content: content,
+		}},
+	}
+}
+
 func (mc *MessageConverter) convertMediaMessage(ctx context.Context, seg onebot.ISegment) *bridgev2.ConvertedMessagePart {
 	if part, err := mc.reploadAttachment(ctx, seg); err != nil {
 		return mc.makeMediaFailure(ctx, err)
@@ -214,6 +414,12 @@ func (mc *MessageConverter) convertShareMessage(title, desc, url string) *bridge
 }
 
 func (mc *MessageConverter) reploadAttachment(ctx context.Context, seg onebot.ISegment) (*bridgev2.ConvertedMessagePart, error) {
+	release, err := mc.acquireMedia(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	content := &event.MessageEventContent{
 		Info: &event.FileInfo{},
 	}
@@ -223,8 +429,23 @@ func (mc *MessageConverter) reploadAttachment(ctx context.Context, seg onebot.IS
 		return nil, fmt.Errorf("failed to download attachment: %w", err)
 	}
 
+	var audio *event.MSC1767Audio
+	if _, ok := seg.(*onebot.RecordSegment); ok {
+		if converted, meta, err := voiceToMatrix(ctx, data, mimetype.Detect(data).String()); errors.Is(err, errSilkUnsupported) {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Agent sent the record as SILK, uploading it as a file")
+		} else if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to convert record, uploading as is")
+		} else {
+			data, audio = converted, meta
+		}
+	}
+
 	mime := mimetype.Detect(data)
 	ext := mime.Extension()
+	silk := isSilk(data)
+	if silk {
+		ext = ".silk"
+	}
 	if filepath.Ext(fileName) == "" {
 		fileName = fileName + ext
 	}
@@ -253,12 +474,25 @@ func (mc *MessageConverter) reploadAttachment(ctx context.Context, seg onebot.IS
 	case *onebot.FileSegment:
 		content.MsgType = event.MsgFile
 	case *onebot.RecordSegment:
+		// Matrix clients can't play SILK, so it is only offered for download
+		if silk {
+			content.MsgType = event.MsgFile
+			break
+		}
 		content.MsgType = event.MsgAudio
-		content.MSC3245Voice = &event.MSC3245Voice{}
+		// Unconverted records are only playable if the agent already sent Ogg
+		if audio != nil {
+			content.MSC3245Voice = &event.MSC3245Voice{}
+			content.MSC1767Audio = audio
+			content.Info.Duration = audio.Duration
+		} else if mime.Is("audio/ogg") {
+			content.MSC3245Voice = &event.MSC3245Voice{}
+		}
 	}
 
 	//content.Body = fileName
 	content.Info.MimeType = mime.String()
+	mc.addMediaMetadata(ctx, content, data, mime)
 
 	return &bridgev2.ConvertedMessagePart{
 		Type:    event.EventMessage,
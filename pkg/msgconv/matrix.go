@@ -67,8 +67,8 @@ func (mc *MessageConverter) convertPill(displayname, mxid, eventID string, ctx f
 	return fmt.Sprintf("@%s", oid)
 }
 
-func getClient(ctx context.Context) *onebot.Client {
-	return ctx.Value(contextKeyClient).(*onebot.Client)
+func getClient(ctx context.Context) onebot.API {
+	return ctx.Value(contextKeyClient).(onebot.API)
 }
 
 func getIntent(ctx context.Context) bridgev2.MatrixAPI {
@@ -0,0 +1,161 @@
+package msgconv
+
+import (
+	"bytes"
+	"context"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/duo/matrix-pylon/pkg/onebot"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/ffmpeg"
+	"maunium.net/go/mautrix/bridgev2"
+	"maunium.net/go/mautrix/event"
+)
+
+// How many attachments of one client are downloaded and processed at the same time
+const maxConcurrentMedia = 4
+
+// How long ffmpeg may take for the metadata of one attachment, it's sent without the metadata after that
+const mediaProbeTimeout = 15 * time.Second
+
+// acquireMedia waits for one of the maxConcurrentMedia slots of the client in the context
+func (mc *MessageConverter) acquireMedia(ctx context.Context) (release func(), err error) {
+	sem, _ := mc.mediaSems.LoadOrStore(getClient(ctx), make(chan struct{}, maxConcurrentMedia))
+	slots := sem.(chan struct{})
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ForgetClient drops the media slots of a client that was logged out
+func (mc *MessageConverter) ForgetClient(client onebot.API) {
+	mc.mediaSems.Delete(client)
+}
+
+// convertMediaMessages converts the media of a message concurrently, keeping the order of the segments
+func (mc *MessageConverter) convertMediaMessages(ctx context.Context, segs []onebot.ISegment) []*bridgev2.ConvertedMessagePart {
+	parts := make([]*bridgev2.ConvertedMessagePart, len(segs))
+
+	var wg sync.WaitGroup
+	for i, seg := range segs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parts[i] = mc.convertMediaMessage(ctx, seg)
+		}()
+	}
+	wg.Wait()
+
+	return parts
+}
+
+// addMediaMetadata fills in what clients need to lay out media before loading it
+func (mc *MessageConverter) addMediaMetadata(ctx context.Context, content *event.MessageEventContent, data []byte, mime *mimetype.MIME) {
+	log := zerolog.Ctx(ctx)
+
+	switch content.MsgType {
+	case event.MsgImage:
+		content.Info.MauGIF = mime.Is("image/gif")
+		if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			content.Info.Width, content.Info.Height = config.Width, config.Height
+			return
+		}
+	case event.MsgVideo:
+	default:
+		return
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, mediaProbeTimeout)
+	defer cancel()
+
+	probe, err := probeMedia(probeCtx, data, mime.Extension())
+	if err != nil {
+		log.Debug().Err(err).Str("msgtype", string(content.MsgType)).Msg("Failed to probe media")
+		return
+	}
+
+	switch content.MsgType {
+	case event.MsgImage:
+		content.Info.Width, content.Info.Height, _ = probeVideo(probe)
+	case event.MsgVideo:
+		content.Info.Width, content.Info.Height, content.Info.Duration = probeVideo(probe)
+		if err := mc.addVideoThumbnail(ctx, probeCtx, content, data, mime.String()); err != nil {
+			log.Warn().Err(err).Msg("Failed to create video thumbnail")
+		}
+	}
+}
+
+// probeMedia runs ffprobe on the data, which has to be written to a file for it
+func probeMedia(ctx context.Context, data []byte, ext string) (*ffmpeg.ProbeResult, error) {
+	if !ffmpeg.ProbeSupported() {
+		return nil, errFFmpegUnsupported
+	}
+
+	dir, err := os.MkdirTemp("", "pylon_probe_*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "media"+ext)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+
+	return ffmpeg.Probe(ctx, path)
+}
+
+// probeVideo returns the dimensions of the first video stream and the duration in milliseconds
+func probeVideo(probe *ffmpeg.ProbeResult) (width, height, duration int) {
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" {
+			width, height = stream.Width, stream.Height
+			duration = int(stream.Duration * 1000)
+			break
+		}
+	}
+	if duration == 0 && probe.Format != nil {
+		duration = int(probe.Format.Duration * 1000)
+	}
+	return
+}
+
+// addVideoThumbnail uploads the first frame of the video as its poster, ffmpeg runs with probeCtx
+func (mc *MessageConverter) addVideoThumbnail(ctx, probeCtx context.Context, content *event.MessageEventContent, data []byte, mime string) error {
+	if !ffmpeg.Supported() {
+		return errFFmpegUnsupported
+	}
+
+	thumbnail, err := ffmpeg.ConvertBytes(probeCtx, data, ".jpg", nil, []string{"-frames:v", "1", "-update", "1", "-q:v", "4"}, mime)
+	if err != nil {
+		return err
+	}
+
+	info := &event.FileInfo{
+		MimeType: "image/jpeg",
+		Size:     len(thumbnail),
+	}
+	if config, _, err := image.DecodeConfig(bytes.NewReader(thumbnail)); err == nil {
+		info.Width, info.Height = config.Width, config.Height
+	}
+
+	content.Info.ThumbnailURL, content.Info.ThumbnailFile, err = getIntent(ctx).UploadMedia(ctx, getPortal(ctx).MXID, thumbnail, "thumbnail.jpg", info.MimeType)
+	if err != nil {
+		return err
+	}
+	content.Info.ThumbnailInfo = info
+
+	return nil
+}
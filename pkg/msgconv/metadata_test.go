@@ -0,0 +1,44 @@
+package msgconv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/duo/matrix-pylon/pkg/onebot"
+)
+
+func TestMediaSlotsArePerClient(t *testing.T) {
+	mc := &MessageConverter{}
+	busy := context.WithValue(context.Background(), contextKeyClient, onebot.API(&onebot.Client{}))
+	idle := context.WithValue(context.Background(), contextKeyClient, onebot.API(&onebot.Client{}))
+
+	var releases []func()
+	for range maxConcurrentMedia {
+		release, err := mc.acquireMedia(busy)
+		if err != nil {
+			t.Fatalf("acquireMedia failed: %v", err)
+		}
+		releases = append(releases, release)
+	}
+
+	full, cancel := context.WithTimeout(busy, 50*time.Millisecond)
+	defer cancel()
+	if _, err := mc.acquireMedia(full); err == nil {
+		t.Fatal("acquired more than maxConcurrentMedia slots")
+	}
+
+	// Another client isn't held up by the busy one
+	release, err := mc.acquireMedia(idle)
+	if err != nil {
+		t.Fatalf("acquireMedia of another client failed: %v", err)
+	}
+	release()
+
+	releases[0]()
+	if release, err := mc.acquireMedia(busy); err != nil {
+		t.Fatalf("acquireMedia after release failed: %v", err)
+	} else {
+		release()
+	}
+}
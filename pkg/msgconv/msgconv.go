@@ -1,6 +1,8 @@
 package msgconv
 
 import (
+	"sync"
+
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/format"
 )
@@ -9,6 +11,12 @@ type MessageConverter struct {
 	Bridge      *bridgev2.Bridge
 	MaxFileSize int64
 	HTMLParser  *format.HTMLParser
+
+	// Files larger than this are sent with upload_*_file instead of a file segment, 0 disables it
+	LargeFileThreshold int64
+
+	// Bounds the number of attachments being processed per client, see maxConcurrentMedia
+	mediaSems sync.Map
 }
 
 func NewMessageConverter(br *bridgev2.Bridge) *MessageConverter {
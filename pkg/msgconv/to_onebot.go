@@ -2,22 +2,25 @@ package msgconv
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/duo/matrix-pylon/pkg/ids"
 	"github.com/duo/matrix-pylon/pkg/onebot"
 
+	"github.com/rs/zerolog"
 	"maunium.net/go/mautrix/bridgev2"
 	"maunium.net/go/mautrix/event"
 )
 
 func (mc *MessageConverter) ToOnebot(
 	ctx context.Context,
-	client *onebot.Client,
+	client onebot.API,
 	evt *event.Event,
 	content *event.MessageEventContent,
 	portal *bridgev2.Portal,
@@ -34,7 +37,19 @@ func (mc *MessageConverter) ToOnebot(
 	switch content.MsgType {
 	case event.MsgText, event.MsgNotice, event.MsgEmote:
 		segments = append(segments, mc.constructTextMessage(ctx, content)...)
-	case event.MessageType(event.EventSticker.Type), event.MsgImage, event.MsgVideo, event.MsgAudio, event.MsgFile:
+	case event.MsgVideo, event.MsgFile:
+		// These are passed on unchanged, so they are streamed through a file instead of memory
+		var sendErr error
+		err := mc.Bridge.Bot.DownloadMediaToFile(ctx, content.URL, content.File, false, func(f *os.File) error {
+			segments, sendErr = mc.constructFileMessage(ctx, content, f)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", bridgev2.ErrMediaDownloadFailed, err)
+		} else if sendErr != nil {
+			return nil, sendErr
+		}
+	case event.MessageType(event.EventSticker.Type), event.MsgImage, event.MsgAudio:
 		data, err := mc.Bridge.Bot.DownloadMedia(ctx, content.URL, content.File)
 		if err != nil {
 			return nil, fmt.Errorf("%w: %w", bridgev2.ErrMediaDownloadFailed, err)
@@ -60,6 +75,11 @@ func (mc *MessageConverter) constructTextMessage(ctx context.Context, content *e
 		mentions = append(mentions, "room")
 	}
 
+	// Mentions only exist in groups
+	if peerType, _ := ids.ParsePortalID(getPortal(ctx).ID); peerType != ids.PeerTypeGroup {
+		mentions = nil
+	}
+
 	if len(mentions) == 0 {
 		return []onebot.ISegment{onebot.NewText(text)}
 	}
@@ -101,61 +121,100 @@ func (mc *MessageConverter) constructTextMessage(ctx context.Context, content *e
 	return segments
 }
 
-func (mc *MessageConverter) constructMediaMessage(_ context.Context, content *event.MessageEventContent, data []byte) []onebot.ISegment {
-	fileName := content.Body
+func mediaFileName(content *event.MessageEventContent) string {
 	if content.FileName != "" {
-		fileName = content.FileName
+		return content.FileName
 	}
+	return content.Body
+}
 
-	base64data := fmt.Sprintf("base64://%s", base64.StdEncoding.EncodeToString(data))
+func (mc *MessageConverter) constructMediaMessage(ctx context.Context, content *event.MessageEventContent, data []byte) []onebot.ISegment {
+	fileName := mediaFileName(content)
+
+	client := getClient(ctx)
+	profile := client.GetProfile()
+	if content.MsgType == event.MsgAudio && content.MSC3245Voice != nil && canSendRecord(client) {
+		if format := profile.VoiceFormat(); format != "" {
+			mime := "audio/ogg"
+			if content.Info != nil && content.Info.MimeType != "" {
+				mime = content.Info.MimeType
+			}
+			if converted, convertedFormat, err := voiceFromMatrix(ctx, data, mime, format); err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Str("format", format).Msg("Failed to convert voice, sending as is")
+			} else {
+				data = converted
+				fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "." + convertedFormat
+			}
+		}
+	}
+
+	return mc.mediaSegments(ctx, content, client.MediaURI(data, fileName), fileName)
+}
+
+// constructFileMessage sends a video or file from disk, large files are uploaded instead
+func (mc *MessageConverter) constructFileMessage(ctx context.Context, content *event.MessageEventContent, f *os.File) ([]onebot.ISegment, error) {
+	fileName := mediaFileName(content)
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	file, err := getClient(ctx).MediaFileURI(f.Name(), fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if content.MsgType == event.MsgFile && mc.LargeFileThreshold > 0 && info.Size() > mc.LargeFileThreshold {
+		// Uploaded files aren't messages, so there is nothing left to send
+		return []onebot.ISegment{}, mc.uploadLargeFile(ctx, file, fileName)
+	}
+
+	return mc.mediaSegments(ctx, content, file, fileName), nil
+}
+
+func canSendRecord(client onebot.API) bool {
+	return client.GetProfile().SupportsSegment(onebot.Record) && client.GetAgentInfo().CanSendRecord
+}
+
+func (mc *MessageConverter) mediaSegments(ctx context.Context, content *event.MessageEventContent, file, fileName string) []onebot.ISegment {
+	client := getClient(ctx)
+
+	// Media the agent can't send as such goes out as a file
+	if (content.MsgType == event.MsgVideo && !client.GetProfile().SupportsSegment(onebot.Video)) ||
+		(content.MsgType == event.MsgAudio && !canSendRecord(client)) {
+		return []onebot.ISegment{onebot.NewFile(file, fileName)}
+	}
 
 	switch content.MsgType {
 	case event.MessageType(event.EventSticker.Type), event.MsgImage:
-		return []onebot.ISegment{onebot.NewImage(base64data, fileName)}
+		return []onebot.ISegment{onebot.NewImage(file, fileName)}
 	case event.MsgVideo:
-		return []onebot.ISegment{onebot.NewVideo(base64data, fileName)}
+		return []onebot.ISegment{onebot.NewVideo(file, fileName)}
 	case event.MsgAudio:
-		return []onebot.ISegment{onebot.NewRecord(base64data, fileName)}
+		return []onebot.ISegment{onebot.NewRecord(file, fileName)}
 	case event.MsgFile:
-		return []onebot.ISegment{onebot.NewFile(base64data, fileName)}
+		return []onebot.ISegment{onebot.NewFile(file, fileName)}
 	}
 
 	return []onebot.ISegment{}
 }
 
-func (mc *MessageConverter) constructLocationMessage(ctx context.Context, name string, lat, lng float64) []onebot.ISegment {
-	agentType := getClient(ctx).GetAgentType()
-	if agentType == onebot.AgentNapCat || agentType == onebot.AgentLLOneBot {
-		locationJson := fmt.Sprintf(`
-		{
-			"app": "com.tencent.map",
-			"desc": "地图",
-			"view": "LocationShare",
-			"ver": "0.0.0.1",
-			"prompt": "[位置]%s",
-			"from": 1,
-			"meta": {
-			  "Location.Search": {
-				"id": "12250896297164027526",
-				"name": "%s",
-				"address": "%s",
-				"lat": "%.5f",
-				"lng": "%.5f",
-				"from": "plusPanel"
-			  }
-			},
-			"config": {
-			  "forward": 1,
-			  "autosize": 1,
-			  "type": "card"
-			}
-		}
-		`, name, name, name, lat, lng)
+func (mc *MessageConverter) uploadLargeFile(ctx context.Context, file, fileName string) error {
+	client := getClient(ctx)
 
-		return []onebot.ISegment{onebot.NewJSON(locationJson)}
+	peerType, peerID := ids.ParsePortalID(getPortal(ctx).ID)
+	switch peerType {
+	case ids.PeerTypeUser:
+		return client.UploadPrivateFile(peerID, file, fileName)
+	case ids.PeerTypeGroup:
+		return client.UploadGroupFile(peerID, file, fileName)
+	default:
+		return fmt.Errorf("unsupported chat type %s", peerType)
 	}
+}
 
-	return []onebot.ISegment{onebot.NewLocation(lat, lng, name, name)}
+func (mc *MessageConverter) constructLocationMessage(ctx context.Context, name string, lat, lng float64) []onebot.ISegment {
+	return getClient(ctx).GetProfile().LocationSegments(name, lat, lng)
 }
 
 func parseGeoURI(uri string) (lat, lng float64, err error) {
@@ -0,0 +1,168 @@
+package msgconv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/ffmpeg"
+	"maunium.net/go/mautrix/event"
+)
+
+const (
+	// Voice is decoded at this rate to measure the duration and waveform
+	waveformSampleRate = 8000
+	// MSC3246 waveforms have up to this many samples, each between 0 and 1024
+	waveformLength = 100
+	waveformMax    = 1024
+)
+
+var (
+	errFFmpegUnsupported = errors.New("ffmpeg is not available")
+	// The agent is asked for converted records, SILK is only left when that failed.
+	// TODO: decode SILK to PCM in Go and feed it to the Opus conversion, there's no decoder in the tree yet.
+	errSilkUnsupported = errors.New("SILK records can't be decoded without the agent converting them")
+)
+
+var (
+	silkHeader = []byte("#!SILK_V3")
+	amrHeader  = []byte("#!AMR")
+)
+
+// isSilk checks for the SILK v3 header, which Tencent prefixes with a 0x02 byte
+func isSilk(data []byte) bool {
+	return bytes.HasPrefix(data, silkHeader) || (len(data) > 0 && data[0] == 0x02 && bytes.HasPrefix(data[1:], silkHeader))
+}
+
+// voiceToMatrix converts a record to Ogg/Opus, with the duration and waveform Matrix clients show for voice messages
+func voiceToMatrix(ctx context.Context, data []byte, mime string) ([]byte, *event.MSC1767Audio, error) {
+	if isSilk(data) {
+		return nil, nil, errSilkUnsupported
+	} else if !ffmpeg.Supported() {
+		return nil, nil, errFFmpegUnsupported
+	}
+
+	if bytes.HasPrefix(data, amrHeader) {
+		mime = "audio/amr"
+	}
+
+	converted, err := ffmpeg.ConvertBytes(ctx, data, ".ogg", nil, []string{"-vn", "-ac", "1", "-c:a", "libopus", "-b:a", "32k"}, mime)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pcm, err := ffmpeg.ConvertBytes(ctx, converted, ".raw", nil, []string{"-f", "s16le", "-ac", "1", "-ar", "8000"}, "audio/ogg")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	samples := make([]int16, len(pcm)/2)
+	if err := binary.Read(bytes.NewReader(pcm[:len(samples)*2]), binary.LittleEndian, samples); err != nil {
+		return nil, nil, err
+	}
+
+	return converted, &event.MSC1767Audio{
+		Duration: len(samples) * 1000 / waveformSampleRate,
+		Waveform: calculateWaveform(samples),
+	}, nil
+}
+
+// calculateWaveform takes the RMS of evenly sized buckets, scaled so that the loudest one is at the maximum
+func calculateWaveform(samples []int16) []int {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	buckets := min(waveformLength, len(samples))
+	levels := make([]float64, buckets)
+	var loudest float64
+	for i := range levels {
+		start, end := i*len(samples)/buckets, (i+1)*len(samples)/buckets
+		var sum float64
+		for _, sample := range samples[start:end] {
+			sum += float64(sample) * float64(sample)
+		}
+		levels[i] = math.Sqrt(sum / float64(end-start))
+		loudest = max(loudest, levels[i])
+	}
+
+	waveform := make([]int, buckets)
+	if loudest == 0 {
+		return waveform
+	}
+	for i, level := range levels {
+		waveform[i] = int(level / loudest * waveformMax)
+	}
+	return waveform
+}
+
+// voiceEncoders lists the encoder used for each format records can be sent in
+var voiceEncoders = map[string]string{
+	"amr": "libopencore_amrnb",
+	"mp3": "libmp3lame",
+	"wav": "pcm_s16le",
+}
+
+var (
+	ffmpegEncoders     string
+	ffmpegEncodersOnce sync.Once
+)
+
+// hasEncoder checks if ffmpeg was built with the encoder, the list is only read once
+func hasEncoder(ctx context.Context, name string) bool {
+	ffmpegEncodersOnce.Do(func() {
+		path, err := exec.LookPath("ffmpeg")
+		if err != nil {
+			return
+		}
+		output, err := exec.CommandContext(ctx, path, "-hide_banner", "-encoders").Output()
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to list ffmpeg encoders")
+			return
+		}
+		ffmpegEncoders = string(output)
+	})
+
+	return strings.Contains(ffmpegEncoders, " "+name+" ")
+}
+
+// voiceFromMatrix converts a Matrix voice message to the format the agent sends records in.
+// Builds of ffmpeg often lack the AMR encoder, then MP3 or WAV is sent, which the agents convert themselves.
+func voiceFromMatrix(ctx context.Context, data []byte, mime, format string) ([]byte, string, error) {
+	if !ffmpeg.Supported() {
+		return nil, "", errFFmpegUnsupported
+	}
+
+	if encoder := voiceEncoders[format]; encoder != "" && !hasEncoder(ctx, encoder) {
+		fallback := "wav"
+		if hasEncoder(ctx, voiceEncoders["mp3"]) {
+			fallback = "mp3"
+		}
+		zerolog.Ctx(ctx).Warn().
+			Str("format", format).
+			Str("fallback", fallback).
+			Msgf("ffmpeg doesn't have the %s encoder, sending voice as %s instead", encoder, fallback)
+		format = fallback
+	}
+
+	var args []string
+	switch format {
+	case "amr":
+		args = []string{"-vn", "-ar", "8000", "-ac", "1", "-c:a", voiceEncoders["amr"], "-b:a", "12.2k"}
+	case "mp3":
+		args = []string{"-vn", "-ac", "1", "-c:a", voiceEncoders["mp3"], "-q:a", "4"}
+	case "wav":
+		args = []string{"-vn", "-ar", "24000", "-ac", "1", "-c:a", voiceEncoders["wav"]}
+	default:
+		args = []string{"-vn"}
+	}
+
+	converted, err := ffmpeg.ConvertBytes(ctx, data, "."+format, nil, args, mime)
+	return converted, format, err
+}
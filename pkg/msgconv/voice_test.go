@@ -0,0 +1,64 @@
+package msgconv
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalculateWaveform(t *testing.T) {
+	if got := calculateWaveform(nil); got != nil {
+		t.Errorf("calculateWaveform(nil) = %v, want nil", got)
+	}
+
+	// Fewer samples than buckets get one bucket each
+	if got := calculateWaveform([]int16{0, 100, -200}); len(got) != 3 || got[0] != 0 || got[2] != waveformMax {
+		t.Errorf("calculateWaveform of 3 samples = %v", got)
+	}
+
+	silence := make([]int16, 1000)
+	for i, level := range calculateWaveform(silence) {
+		if level != 0 {
+			t.Fatalf("silence has level %d at %d", level, i)
+		}
+	}
+
+	// A sine getting louder has a rising waveform, peaking at the maximum
+	samples := make([]int16, waveformSampleRate)
+	for i := range samples {
+		amplitude := float64(i) / float64(len(samples)) * math.MaxInt16
+		samples[i] = int16(amplitude * math.Sin(float64(i)/5))
+	}
+	waveform := calculateWaveform(samples)
+	if len(waveform) != waveformLength {
+		t.Fatalf("got %d levels, want %d", len(waveform), waveformLength)
+	}
+	if waveform[len(waveform)-1] != waveformMax {
+		t.Errorf("last level is %d, want %d", waveform[len(waveform)-1], waveformMax)
+	}
+	for i := 1; i < len(waveform); i++ {
+		if waveform[i] < 0 || waveform[i] > waveformMax {
+			t.Fatalf("level %d out of range at %d", waveform[i], i)
+		}
+		if waveform[i]+waveformMax/20 < waveform[i-1] {
+			t.Errorf("waveform drops from %d to %d at %d", waveform[i-1], waveform[i], i)
+		}
+	}
+}
+
+func TestIsSilk(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want bool
+	}{
+		{[]byte("#!SILK_V3\x00"), true},
+		{[]byte("\x02#!SILK_V3\x00"), true},
+		{[]byte("#!AMR\n"), false},
+		{[]byte("\x02"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isSilk(tt.data); got != tt.want {
+			t.Errorf("isSilk(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package onebot
+
+import "strings"
+
+func (t AgentType) String() string {
+	switch t {
+	case AgentNapCat:
+		return "napcat"
+	case AgentLLOneBot:
+		return "llonebot"
+	case AgentWeChat:
+		return "wechat"
+	case AgentSatori:
+		return "satori"
+	default:
+		return "unknown"
+	}
+}
+
+// AgentInfo is what the agent reported about itself when it connected
+type AgentInfo struct {
+	AppName         string
+	AppVersion      string
+	ProtocolVersion string
+
+	CanSendImage  bool
+	CanSendRecord bool
+}
+
+// Until the agent has been queried it is assumed to be able to send everything
+var defaultAgentInfo = AgentInfo{CanSendImage: true, CanSendRecord: true}
+
+// GetAgentInfo returns the version and capabilities of the agent, as discovered on connect
+func (c *Client) GetAgentInfo() AgentInfo {
+	if info := c.agentInfo.Load(); info != nil {
+		return *info
+	}
+	return defaultAgentInfo
+}
+
+// discoverAgent queries the version and capabilities of the agent, the agent type is
+// refined from the reported app name as the User-Agent isn't sent by every transport
+func (c *Client) discoverAgent() {
+	info := defaultAgentInfo
+
+	if version, err := c.GetVersionInfo(); err != nil {
+		c.log.Warn().Err(err).Msg("Failed to get version info")
+	} else if version != nil {
+		info.AppName = version.AppName
+		info.AppVersion = version.AppVersion
+		info.ProtocolVersion = version.ProtocolVersion
+
+		if agentType, ok := agentTypeFromApp(version.AppName); ok {
+			c.setAgentType(agentType)
+		}
+	}
+
+	// Agents without these actions are assumed to support both
+	if yes, err := c.CanSendImage(); err != nil {
+		c.log.Debug().Err(err).Msg("Failed to check if images can be sent")
+	} else {
+		info.CanSendImage = yes
+	}
+	if yes, err := c.CanSendRecord(); err != nil {
+		c.log.Debug().Err(err).Msg("Failed to check if records can be sent")
+	} else {
+		info.CanSendRecord = yes
+	}
+
+	c.agentInfo.Store(&info)
+
+	c.log.Info().
+		Stringer("agent_type", c.GetAgentType()).
+		Str("app_name", info.AppName).
+		Str("app_version", info.AppVersion).
+		Str("protocol_version", info.ProtocolVersion).
+		Bool("can_send_image", info.CanSendImage).
+		Bool("can_send_record", info.CanSendRecord).
+		Msg("Discovered agent")
+}
+
+func agentTypeFromApp(appName string) (AgentType, bool) {
+	name := strings.ToLower(appName)
+	switch {
+	case strings.Contains(name, "napcat"):
+		return AgentNapCat, true
+	case strings.Contains(name, "llonebot"):
+		return AgentLLOneBot, true
+	case strings.Contains(name, "wechat"), strings.Contains(name, "wxbot"):
+		return AgentWeChat, true
+	default:
+		return AgentNapCat, false
+	}
+}
@@ -22,6 +22,42 @@ func (c *Client) GetLoginInfo() (*UserInfo, error) {
 	return info, err
 }
 
+func (c *Client) GetVersionInfo() (*VersionInfo, error) {
+	resp, err := c.request(NewGetVersionInfoRequest())
+	if err != nil {
+		return nil, err
+	}
+
+	var info *VersionInfo
+	err = mapstructure.WeakDecode(resp, &info)
+
+	return info, err
+}
+
+func (c *Client) CanSendImage() (bool, error) {
+	resp, err := c.request(NewCanSendImageRequest())
+	if err != nil {
+		return false, err
+	}
+
+	var yes YesResponse
+	err = mapstructure.WeakDecode(resp, &yes)
+
+	return yes.Yes, err
+}
+
+func (c *Client) CanSendRecord() (bool, error) {
+	resp, err := c.request(NewCanSendRecordRequest())
+	if err != nil {
+		return false, err
+	}
+
+	var yes YesResponse
+	err = mapstructure.WeakDecode(resp, &yes)
+
+	return yes.Yes, err
+}
+
 func (c *Client) GetUserInfo(userID string) (*UserInfo, error) {
 	resp, err := c.request(NewGetUserInfoRequest(userID))
 	if err != nil {
@@ -118,12 +154,231 @@ func (c *Client) SendGroupMessage(groupID string, segments []ISegment) (*SendMes
 	return msgResp, err
 }
 
+func (c *Client) SendPrivateForwardMessage(userID string, nodes []ISegment) (*SendMessageResponse, error) {
+	resp, err := c.request(NewPrivateForwardMsgRequest(userID, nodes))
+	if err != nil {
+		return nil, err
+	}
+
+	var msgResp *SendMessageResponse
+	err = mapstructure.WeakDecode(resp, &msgResp)
+
+	return msgResp, err
+}
+
+func (c *Client) SendGroupForwardMessage(groupID string, nodes []ISegment) (*SendMessageResponse, error) {
+	resp, err := c.request(NewGroupForwardMsgRequest(groupID, nodes))
+	if err != nil {
+		return nil, err
+	}
+
+	var msgResp *SendMessageResponse
+	err = mapstructure.WeakDecode(resp, &msgResp)
+
+	return msgResp, err
+}
+
+func (c *Client) SendForwardMessage(messageType, targetID string, nodes []ISegment) (*SendMessageResponse, error) {
+	resp, err := c.request(NewForwardMsgRequest(messageType, targetID, nodes))
+	if err != nil {
+		return nil, err
+	}
+
+	var msgResp *SendMessageResponse
+	err = mapstructure.WeakDecode(resp, &msgResp)
+
+	return msgResp, err
+}
+
+func (c *Client) GetMessage(messageID string) (*Message, error) {
+	resp, err := c.request(NewGetMsgRequest(messageID))
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := resp.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("无效的消息数据: %+v", resp)
+	}
+
+	msg, err := unmarshalMessage(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg.(*Message), nil
+}
+
+func (c *Client) GetGroupMsgHistory(groupID, messageSeq string, count int) ([]*Message, error) {
+	resp, err := c.request(NewGetGroupMsgHistoryRequest(groupID, messageSeq, count))
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMessageHistory(resp)
+}
+
+func (c *Client) GetFriendMsgHistory(userID, messageSeq string, count int) ([]*Message, error) {
+	resp, err := c.request(NewGetFriendMsgHistoryRequest(userID, messageSeq, count))
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMessageHistory(resp)
+}
+
+func (c *Client) GetForwardMessage(messageID string) ([]*Message, error) {
+	resp, err := c.request(NewGetForwardMsgRequest(messageID))
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMessageHistory(resp)
+}
+
+func decodeMessageHistory(resp any) ([]*Message, error) {
+	var history struct {
+		Messages []map[string]interface{} `mapstructure:"messages"`
+	}
+	if err := mapstructure.WeakDecode(resp, &history); err != nil {
+		return nil, err
+	}
+
+	messages := make([]*Message, 0, len(history.Messages))
+	for _, m := range history.Messages {
+		msg, err := unmarshalMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg.(*Message))
+	}
+
+	return messages, nil
+}
+
 func (c *Client) DeleteMessage(messageID string) error {
 	_, err := c.request(NewDeleteMsgRequest(messageID))
 
 	return err
 }
 
+func (c *Client) SetFriendAddRequest(flag string, approve bool) error {
+	_, err := c.request(NewSetFriendAddRequestRequest(flag, approve))
+
+	return err
+}
+
+func (c *Client) SetGroupAddRequest(flag, subType string, approve bool, reason string) error {
+	_, err := c.request(NewSetGroupAddRequestRequest(flag, subType, approve, reason))
+
+	return err
+}
+
+func (c *Client) SetGroupKick(groupID, userID string, rejectAddRequest bool) error {
+	_, err := c.request(NewSetGroupKickRequest(groupID, userID, rejectAddRequest))
+
+	return err
+}
+
+func (c *Client) SetGroupLeave(groupID string) error {
+	_, err := c.request(NewSetGroupLeaveRequest(groupID))
+
+	return err
+}
+
+func (c *Client) SetGroupName(groupID, name string) error {
+	_, err := c.request(NewSetGroupNameRequest(groupID, name))
+
+	return err
+}
+
+func (c *Client) SetGroupCard(groupID, userID, card string) error {
+	_, err := c.request(NewSetGroupCardRequest(groupID, userID, card))
+
+	return err
+}
+
+func (c *Client) SetGroupPortrait(groupID, file string) error {
+	_, err := c.request(NewSetGroupPortraitRequest(groupID, file))
+
+	return err
+}
+
+func (c *Client) SetGroupAdmin(groupID, userID string, enable bool) error {
+	_, err := c.request(NewSetGroupAdminRequest(groupID, userID, enable))
+
+	return err
+}
+
+func (c *Client) SetGroupBan(groupID, userID string, duration time.Duration) error {
+	_, err := c.request(NewSetGroupBanRequest(groupID, userID, int64(duration.Seconds())))
+
+	return err
+}
+
+func (c *Client) SetGroupWholeBan(groupID string, enable bool) error {
+	_, err := c.request(NewSetGroupWholeBanRequest(groupID, enable))
+
+	return err
+}
+
+func (c *Client) SetMsgEmojiLike(messageID, emojiID string, set bool) error {
+	_, err := c.request(NewSetMsgEmojiLikeRequest(messageID, emojiID, set))
+
+	return err
+}
+
+// GroupPoke uses send_poke on agents that only have that, e.g. LLOneBot
+func (c *Client) GroupPoke(groupID, userID string) error {
+	request := NewGroupPokeRequest(groupID, userID)
+	if c.GetProfile().SupportsAction(SendPoke) {
+		request = NewSendPokeRequest(groupID, userID)
+	}
+	_, err := c.request(request)
+
+	return err
+}
+
+func (c *Client) FriendPoke(userID string) error {
+	request := NewFriendPokeRequest(userID)
+	if c.GetProfile().SupportsAction(SendPoke) {
+		request = NewSendPokeRequest("", userID)
+	}
+	_, err := c.request(request)
+
+	return err
+}
+
+func (c *Client) UploadGroupFile(groupID, file, name string) error {
+	_, err := c.request(NewUploadGroupFileRequest(groupID, file, name))
+
+	return err
+}
+
+func (c *Client) UploadPrivateFile(userID, file, name string) error {
+	_, err := c.request(NewUploadPrivateFileRequest(userID, file, name))
+
+	return err
+}
+
+func (c *Client) MarkMsgAsRead(messageID string) error {
+	_, err := c.request(NewMarkMsgAsReadRequest(messageID))
+
+	return err
+}
+
+func (c *Client) MarkPrivateMsgAsRead(userID string) error {
+	_, err := c.request(NewMarkPrivateMsgAsReadRequest(userID))
+
+	return err
+}
+
+func (c *Client) MarkGroupMsgAsRead(groupID string) error {
+	_, err := c.request(NewMarkGroupMsgAsReadRequest(groupID))
+
+	return err
+}
+
 func (c *Client) DownloadMedia(seg ISegment) (string, []byte, error) {
 	var request *Request
 	var url string
@@ -140,6 +395,7 @@ func (c *Client) DownloadMedia(seg ISegment) (string, []byte, error) {
 		url = v.URL()
 	case *FileSegment:
 		request = NewGetFileRequest(v.File())
+		url = v.URL()
 	case *RecordSegment:
 		request = NewGetRecordRequest(v.File())
 	default:
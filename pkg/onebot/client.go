@@ -1,24 +1,58 @@
 package onebot
 
 import (
+	"cmp"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
 )
 
+// ClientStatus is the state of the agent as seen through the connection, heartbeats and lifecycle events
+type ClientStatus int32
+
+const (
+	StatusUnknown ClientStatus = iota
+	StatusConnected
+	StatusDisconnected
+	StatusHeartbeatTimeout
+	StatusOffline
+	StatusUnhealthy
+	StatusDisabled
+)
+
+func (s ClientStatus) String() string {
+	switch s {
+	case StatusConnected:
+		return "connected"
+	case StatusDisconnected:
+		return "disconnected"
+	case StatusHeartbeatTimeout:
+		return "heartbeat_timeout"
+	case StatusOffline:
+		return "offline"
+	case StatusUnhealthy:
+		return "unhealthy"
+	case StatusDisabled:
+		return "disabled"
+	default:
+		return "unknown"
+	}
+}
+
 type AgentType int
 
 const (
 	AgentNapCat AgentType = iota
 	AgentLLOneBot
 	AgentWeChat
+	AgentSatori
 )
 
 type Client struct {
@@ -26,21 +60,44 @@ type Client struct {
 
 	id        string
 	token     string
-	agentType AgentType
+	agentType atomic.Int32
+	agentInfo atomic.Pointer[AgentInfo]
 	service   *Service
 
 	eventHandler func(IEvent)
 
-	conn     *websocket.Conn
-	connLock sync.Mutex
+	transport  Transport
+	protocol   protocol
+	connLock   sync.Mutex
+	cancelDial context.CancelFunc
 
 	isLoggedIn    atomic.Bool
-	statusChannel chan bool
+	statusChannel chan Status
 	cancelChecker context.CancelFunc
 
 	websocketRequests     map[string]chan<- *Response
 	websocketRequestsLock sync.RWMutex
 	websocketRequestID    int64
+
+	statusHandler func(ClientStatus)
+	lastStatus    atomic.Int32
+	statusLock    sync.Mutex
+
+	// Guarded by connLock
+	disconnectedAt time.Time
+	queuedRequests []*queuedRequest
+	sentRequests   map[string]*queuedRequest
+}
+
+var (
+	errRequeued     = errors.New("request requeued")
+	errNotConnected = errors.New("websocket未连接")
+)
+
+// queuedRequest is a request waiting for a connection or for its response
+type queuedRequest struct {
+	req     *Request
+	written chan error
 }
 
 func NewClient(log zerolog.Logger, id, token string, service *Service) *Client {
@@ -49,42 +106,35 @@ func NewClient(log zerolog.Logger, id, token string, service *Service) *Client {
 		id:                id,
 		token:             token,
 		service:           service,
-		statusChannel:     make(chan bool),
+		protocol:          newProtocol(ProtocolV11),
+		statusChannel:     make(chan Status),
 		websocketRequests: make(map[string]chan<- *Response),
+		disconnectedAt:    time.Now(),
+		sentRequests:      make(map[string]*queuedRequest),
 	}
 }
 
-func (c *Client) StartLoop(conn *websocket.Conn) {
-	c.updateConnection(conn)
+func (c *Client) StartLoop(t Transport) {
+	c.updateConnection(t)
+	go c.discoverAgent()
 
-	defer func() {
-		c.connLock.Lock()
-		if c.conn == conn {
-			c.conn = nil
-		}
-		c.connLock.Unlock()
-	}()
+	defer c.connectionLost(t)
 
 	for {
-		t, message, err := conn.ReadMessage()
+		m, err := t.ReadPayload()
 		if err != nil {
 			c.log.Warn().Err(err).Msg("Failed to read message from connection")
 			return
 		}
 
-		if t != websocket.TextMessage {
-			continue
-		}
+		c.log.Trace().Msgf("Receive Onebot payload: %+v", m)
 
-		var m map[string]interface{}
-		if err := json.Unmarshal(message, &m); err != nil {
-			c.log.Warn().Err(err).Msg("Failed to unmarshal JSON")
-			break
+		// Discovery has to be redone in the protocol the agent actually speaks
+		if isV12Payload(m) && c.setProtocolVersion(ProtocolV12) {
+			go c.discoverAgent()
 		}
 
-		c.log.Trace().Msgf("Receive Onebot payload: %+v", m)
-
-		payload, err := UnmarshalPayload(m)
+		payload, err := c.getProtocol().decodePayload(m)
 		if err != nil {
 			c.log.Warn().Err(err).Msg("Failed to unmarshal payload")
 			continue
@@ -103,15 +153,20 @@ func (c *Client) StartLoop(conn *websocket.Conn) {
 			switch payload.(IEvent).EventType() {
 			case MetaLifecycle:
 				lifecycle := payload.(*Lifecycle)
-				if lifecycle.SubType == "connect" {
+				switch lifecycle.SubType {
+				case "connect", "enable":
 					c.isLoggedIn.Store(true)
+					c.setStatus(StatusConnected)
+				case "disable":
+					c.isLoggedIn.Store(false)
+					c.setStatus(StatusDisabled)
 				}
 			case MetaHeartbeat:
 				heartbeat := payload.(*Heartbeat)
 				if c.cancelChecker == nil {
 					c.startChecker(uint32(heartbeat.Interval))
 				}
-				c.statusChannel <- heartbeat.Status.Online
+				c.statusChannel <- heartbeat.Status
 			}
 		}
 	}
@@ -121,15 +176,52 @@ func (c *Client) SetEventHandler(handler func(IEvent)) {
 	c.eventHandler = handler
 }
 
+// SetStatusHandler sets a callback for when the status of the agent changes
+func (c *Client) SetStatusHandler(handler func(ClientStatus)) {
+	c.statusHandler = handler
+}
+
+func (c *Client) GetStatus() ClientStatus {
+	return ClientStatus(c.lastStatus.Load())
+}
+
+// setStatus calls the handler synchronously under statusLock, so that changes are delivered in order
+func (c *Client) setStatus(status ClientStatus) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	if ClientStatus(c.lastStatus.Swap(int32(status))) == status {
+		return
+	}
+
+	c.log.Debug().Stringer("status", status).Msg("Client status changed")
+	if c.statusHandler != nil {
+		c.statusHandler(status)
+	}
+}
+
 func (c *Client) Release() {
+	c.connLock.Lock()
+	if c.cancelDial != nil {
+		c.cancelDial()
+		c.cancelDial = nil
+	}
+	c.connLock.Unlock()
+
 	c.updateConnection(nil)
 
+	// Nothing will be flushed after release
+	c.connLock.Lock()
+	c.disconnectedAt = time.Time{}
+	c.failRequests(errNotConnected)
+	c.connLock.Unlock()
+
 	if c.cancelChecker != nil {
 		c.cancelChecker()
 		c.cancelChecker = nil
 	}
 
-	c.service.removeClient(c.id)
+	c.service.removeClient(c)
 }
 
 func (c *Client) GetToken() string {
@@ -141,7 +233,24 @@ func (c *Client) IsLoggedIn() bool {
 }
 
 func (c *Client) GetAgentType() AgentType {
-	return c.agentType
+	return AgentType(c.agentType.Load())
+}
+
+func (c *Client) setAgentType(agentType AgentType) {
+	c.agentType.Store(int32(agentType))
+}
+
+// IsReconnecting reports whether the agent is disconnected but still within the grace period,
+// requests made during that time are queued until it comes back
+func (c *Client) IsReconnecting() bool {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	return c.inGracePeriod()
+}
+
+func (c *Client) inGracePeriod() bool {
+	return c.transport == nil && !c.disconnectedAt.IsZero() && time.Since(c.disconnectedAt) < c.service.reconnectGrace
 }
 
 func (c *Client) startChecker(interval uint32) {
@@ -155,9 +264,10 @@ func (c *Client) startChecker(interval uint32) {
 		for {
 			select {
 			case status := <-c.statusChannel:
-				c.isLoggedIn.Store(status)
+				c.applyStatus(status)
 			case <-time.After(checkInterval):
 				c.isLoggedIn.Store(false)
+				c.setStatus(StatusHeartbeatTimeout)
 			case <-ctx.Done():
 				c.log.Info().Msgf("Status checker stopped")
 				return
@@ -166,19 +276,86 @@ func (c *Client) startChecker(interval uint32) {
 	}()
 }
 
-func (c *Client) updateConnection(conn *websocket.Conn) {
+func (c *Client) applyStatus(status Status) {
+	c.isLoggedIn.Store(status.Online)
+	if !status.Online {
+		c.setStatus(StatusOffline)
+	} else if !status.Good {
+		c.setStatus(StatusUnhealthy)
+	} else {
+		c.setStatus(StatusConnected)
+	}
+}
+
+func (c *Client) updateConnection(t Transport) {
 	c.connLock.Lock()
-	defer c.connLock.Unlock()
 
-	if c.conn != nil {
-		c.conn.Close()
+	if c.transport != nil {
+		c.transport.Close()
+	}
+	c.transport = t
+
+	if t == nil {
+		if c.disconnectedAt.IsZero() {
+			c.disconnectedAt = time.Now()
+		}
+		c.connLock.Unlock()
+		return
+	}
+	c.disconnectedAt = time.Time{}
+
+	// Resend requests that never got a response, then the ones queued while offline
+	pending := make([]*queuedRequest, 0, len(c.sentRequests)+len(c.queuedRequests))
+	for _, q := range c.sentRequests {
+		pending = append(pending, q)
+	}
+	slices.SortFunc(pending, func(a, b *queuedRequest) int {
+		return cmp.Compare(echoOrder(a.req.Echo), echoOrder(b.req.Echo))
+	})
+	pending = append(pending, c.queuedRequests...)
+	c.queuedRequests = nil
+	clear(c.sentRequests)
+
+	if len(pending) > 0 {
+		c.log.Info().Int("count", len(pending)).Msg("Flushing queued requests")
+	}
+	for _, q := range pending {
+		c.writeRequest(q)
 	}
-	c.conn = conn
+	c.connLock.Unlock()
+}
+
+func (c *Client) connectionLost(t Transport) {
+	c.connLock.Lock()
+	if c.transport != t {
+		c.connLock.Unlock()
+		return
+	}
+	c.transport = nil
+	c.disconnectedAt = time.Now()
+	// Unanswered requests get the grace period to be resent on the next connection
+	if c.service.reconnectGrace > 0 {
+		for _, q := range c.sentRequests {
+			select {
+			case q.written <- errRequeued:
+			default:
+			}
+		}
+	} else {
+		c.failRequests(errNotConnected)
+	}
+	c.connLock.Unlock()
+
+	c.setStatus(StatusDisconnected)
 }
 
 func (c *Client) request(req *Request) (any, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.service.timeout)
-	defer cancel()
+	p := c.getProtocol()
+	action := req.Action
+	req, err := p.encodeRequest(c, req)
+	if err != nil {
+		return nil, err
+	}
 
 	req.Echo = fmt.Sprint(atomic.AddInt64(&c.websocketRequestID, 1))
 
@@ -192,34 +369,127 @@ func (c *Client) request(req *Request) (any, error) {
 		Str("action", req.Action).
 		Any("timeout", c.service.timeout).
 		Msgf("Send Onebot request %+v", req)
-	if err := c._request(req); err != nil {
+
+	q := &queuedRequest{req: req, written: make(chan error, 1)}
+	grace, err := c._request(q)
+	if err != nil {
 		return nil, err
 	}
+	defer c.forgetRequest(q)
 
-	select {
-	case resp := <-respChan:
-		if resp.Status != "ok" {
-			return resp, fmt.Errorf("%s Onebot错误代码: %d", resp.Status, resp.Retcode)
-		} else {
-			return resp.Data, nil
+	// Queued requests wait for the agent to come back before the usual timeout starts
+	timeout := time.NewTimer(c.service.timeout)
+	if grace > 0 {
+		timeout.Reset(grace)
+	}
+	defer timeout.Stop()
+
+	for {
+		select {
+		case err := <-q.written:
+			if errors.Is(err, errRequeued) {
+				timeout.Reset(c.service.reconnectGrace)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			timeout.Reset(c.service.timeout)
+		case resp := <-respChan:
+			if resp.Status != "ok" {
+				return resp, fmt.Errorf("%s Onebot错误代码: %d", resp.Status, resp.Retcode)
+			} else {
+				return p.decodeResponse(action, resp.Data), nil
+			}
+		case <-timeout.C:
+			if c.forgetRequest(q) {
+				return nil, errNotConnected
+			}
+			return nil, context.DeadlineExceeded
+		}
+	}
+}
+
+// _request writes the request, or queues it if the agent is reconnecting.
+// For queued requests it returns how long to wait for the connection.
+func (c *Client) _request(q *queuedRequest) (time.Duration, error) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	if c.transport == nil {
+		if !c.inGracePeriod() {
+			return 0, errNotConnected
 		}
-	case <-ctx.Done():
-		return nil, ctx.Err()
+		c.queuedRequests = append(c.queuedRequests, q)
+		return c.service.reconnectGrace - time.Since(c.disconnectedAt), nil
+	}
+
+	if err := c.transport.WriteRequest(q.req); err != nil {
+		return 0, err
+	}
+	c.sentRequests[q.req.Echo] = q
+
+	return 0, nil
+}
+
+// writeRequest sends a previously queued request, connLock must be held
+func (c *Client) writeRequest(q *queuedRequest) {
+	err := c.transport.WriteRequest(q.req)
+	if err == nil {
+		c.sentRequests[q.req.Echo] = q
+	}
+	select {
+	case q.written <- err:
+	default:
 	}
 }
 
-func (c *Client) _request(req *Request) error {
+// failRequests gives up on all sent and queued requests, connLock must be held
+func (c *Client) failRequests(err error) {
+	for _, q := range c.sentRequests {
+		failRequest(q, err)
+	}
+	clear(c.sentRequests)
+	for _, q := range c.queuedRequests {
+		failRequest(q, err)
+	}
+	c.queuedRequests = nil
+}
+
+// failRequest replaces an unread requeue notice, so the waiter sees the error
+func failRequest(q *queuedRequest, err error) {
+	select {
+	case <-q.written:
+	default:
+	}
+	select {
+	case q.written <- err:
+	default:
+	}
+}
+
+// forgetRequest drops a request from the queues, reporting whether the agent is currently disconnected
+func (c *Client) forgetRequest(q *queuedRequest) bool {
 	c.connLock.Lock()
 	defer c.connLock.Unlock()
 
-	if c.conn == nil {
-		return errors.New("websocket未连接")
+	delete(c.sentRequests, q.req.Echo)
+	if i := slices.Index(c.queuedRequests, q); i >= 0 {
+		c.queuedRequests = slices.Delete(c.queuedRequests, i, i+1)
 	}
+	return c.transport == nil
+}
 
-	return c.conn.WriteJSON(req)
+func echoOrder(echo string) int64 {
+	n, _ := strconv.ParseInt(echo, 10, 64)
+	return n
 }
 
 func (c *Client) handleResponse(resp *Response) {
+	// Answered requests must not be resent after a reconnect
+	c.connLock.Lock()
+	delete(c.sentRequests, resp.Echo)
+	c.connLock.Unlock()
+
 	c.websocketRequestsLock.RLock()
 	respChan, ok := c.websocketRequests[resp.Echo]
 	c.websocketRequestsLock.RUnlock()
@@ -0,0 +1,162 @@
+package onebot
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// fakeTransport hands written requests to the test, nothing is ever read from it
+type fakeTransport struct {
+	written chan *Request
+	done    chan struct{}
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{written: make(chan *Request, 8), done: make(chan struct{})}
+}
+
+func (t *fakeTransport) WriteRequest(req *Request) error {
+	t.written <- req
+	return nil
+}
+
+func (t *fakeTransport) ReadPayload() (map[string]interface{}, error) {
+	<-t.done
+	return nil, errTransportClosed
+}
+
+func (t *fakeTransport) Close() error {
+	return nil
+}
+
+func (t *fakeTransport) next(tb testing.TB) *Request {
+	tb.Helper()
+	select {
+	case req := <-t.written:
+		return req
+	case <-time.After(time.Second):
+		tb.Fatal("no request was written")
+		return nil
+	}
+}
+
+func newTestClient(reconnectGrace time.Duration) *Client {
+	service := &Service{
+		timeout:        time.Second,
+		reconnectGrace: reconnectGrace,
+		clients:        make(map[string]*Client),
+		shadowed:       make(map[*Client]*Client),
+	}
+	return NewClient(zerolog.Nop(), "1", "token", service)
+}
+
+type requestResult struct {
+	data any
+	err  error
+}
+
+func startRequest(c *Client) <-chan requestResult {
+	result := make(chan requestResult, 1)
+	go func() {
+		data, err := c.request(&Request{Action: string(GetStatus)})
+		result <- requestResult{data, err}
+	}()
+	return result
+}
+
+func waitResult(tb testing.TB, result <-chan requestResult) requestResult {
+	tb.Helper()
+	select {
+	case r := <-result:
+		return r
+	case <-time.After(2 * time.Second):
+		tb.Fatal("request didn't return")
+		return requestResult{}
+	}
+}
+
+func TestRequestReplayedAfterReconnect(t *testing.T) {
+	c := newTestClient(5 * time.Second)
+	first := newFakeTransport()
+	c.updateConnection(first)
+
+	result := startRequest(c)
+	sent := first.next(t)
+
+	// The connection drops before the response arrives
+	c.connectionLost(first)
+
+	second := newFakeTransport()
+	c.updateConnection(second)
+	replayed := second.next(t)
+	if replayed.Echo != sent.Echo {
+		t.Fatalf("replayed echo %q, want %q", replayed.Echo, sent.Echo)
+	}
+
+	c.handleResponse(&Response{Status: "ok", Echo: sent.Echo, Data: "done"})
+	if r := waitResult(t, result); r.err != nil || r.data != "done" {
+		t.Fatalf("request returned %v, %v", r.data, r.err)
+	}
+
+	// Answered requests are not sent again
+	c.connectionLost(second)
+	third := newFakeTransport()
+	c.updateConnection(third)
+	select {
+	case req := <-third.written:
+		t.Fatalf("answered request %q was replayed", req.Echo)
+	default:
+	}
+}
+
+func TestRequestQueuedWhileReconnecting(t *testing.T) {
+	c := newTestClient(5 * time.Second)
+	first := newFakeTransport()
+	c.updateConnection(first)
+	c.connectionLost(first)
+
+	result := startRequest(c)
+	// Give the request time to be queued
+	time.Sleep(50 * time.Millisecond)
+
+	second := newFakeTransport()
+	c.updateConnection(second)
+	req := second.next(t)
+
+	c.handleResponse(&Response{Status: "ok", Echo: req.Echo, Data: "done"})
+	if r := waitResult(t, result); r.err != nil || r.data != "done" {
+		t.Fatalf("request returned %v, %v", r.data, r.err)
+	}
+}
+
+func TestReleaseFailsPendingRequests(t *testing.T) {
+	c := newTestClient(5 * time.Second)
+	first := newFakeTransport()
+	c.updateConnection(first)
+
+	result := startRequest(c)
+	first.next(t)
+	c.connectionLost(first)
+
+	c.Release()
+	if r := waitResult(t, result); !errors.Is(r.err, errNotConnected) {
+		t.Fatalf("request returned %v, want %v", r.err, errNotConnected)
+	}
+}
+
+func TestConnectionLostWithoutGraceFailsRequests(t *testing.T) {
+	c := newTestClient(0)
+	first := newFakeTransport()
+	c.updateConnection(first)
+
+	result := startRequest(c)
+	first.next(t)
+	c.connectionLost(first)
+
+	if r := waitResult(t, result); !errors.Is(r.err, errNotConnected) {
+		t.Fatalf("request returned %v, want %v", r.err, errNotConnected)
+	}
+}
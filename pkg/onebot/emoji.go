@@ -1,10 +1,10 @@
-package msgconv
+package onebot
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
-
-	"github.com/duo/matrix-pylon/pkg/onebot"
+	"unicode/utf8"
 )
 
 var qqEmoji = map[string]string{
@@ -414,21 +414,58 @@ var wechatEmoji = strings.NewReplacer(
 	"[笑脸]", "😁", "[Happy]", "😁",
 )
 
-func convertOnebotFace(client *onebot.Client, id string) string {
-	agentType := client.GetAgentType()
-	if agentType == onebot.AgentLLOneBot || agentType == onebot.AgentNapCat {
-		if v, ok := qqEmoji[id]; ok {
-			return fmt.Sprintf("/%s", v)
+var qqEmojiByName = func() map[string]string {
+	m := make(map[string]string, len(qqEmoji))
+	for id, name := range qqEmoji {
+		// Prefer the lowest face ID if a name is used more than once
+		if old, ok := m[name]; ok {
+			oldID, _ := strconv.Atoi(old)
+			newID, _ := strconv.Atoi(id)
+			if oldID < newID {
+				continue
+			}
 		}
+		m[name] = id
+	}
+	return m
+}()
+
+// faceToReaction converts a face or emoji-like ID to a Matrix reaction key, names come from faces if given
+func faceToReaction(faces map[string]string, id string) string {
+	if v, ok := faces[id]; ok {
+		return fmt.Sprintf("/%s", v)
+	}
+	// IDs of Unicode emoji are their code points
+	if cp, err := strconv.Atoi(id); err == nil && cp > 0xFF && utf8.ValidRune(rune(cp)) {
+		return string(rune(cp))
 	}
 
 	return fmt.Sprintf("/[Face%s]", id)
 }
 
-func convertOnebotEmoji(client *onebot.Client, content string) string {
-	if client.GetAgentType() == onebot.AgentWeChat {
-		return wechatEmoji.Replace(content)
+// reactionToFace converts a Matrix reaction key to a QQ emoji-like ID
+func reactionToFace(key string) (string, bool) {
+	key = strings.TrimSuffix(key, "\ufe0f")
+
+	if name, ok := strings.CutPrefix(key, "/"); ok {
+		if id, ok := qqEmojiByName[name]; ok {
+			return id, true
+		}
+		if id, ok := strings.CutPrefix(name, "[Face"); ok {
+			id = strings.TrimSuffix(id, "]")
+			if _, err := strconv.Atoi(id); err == nil {
+				return id, true
+			}
+		}
+		return "", false
+	}
+
+	if id, ok := qqEmojiByName[key]; ok {
+		return id, true
+	}
+	if r, size := utf8.DecodeRuneInString(key); size == len(key) && r > 0xFF {
+		return strconv.Itoa(int(r)), true
 	}
 
-	return content
+	return "", false
 }
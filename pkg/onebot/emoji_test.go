@@ -0,0 +1,61 @@
+package onebot
+
+import "testing"
+
+func TestFaceToReaction(t *testing.T) {
+	profile := ProfileFor(AgentNapCat)
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"14", "/微笑"},
+		{"128077", "👍"},
+		{"9999999", "/[Face9999999]"},
+		{"abc", "/[Faceabc]"},
+	}
+	for _, tt := range tests {
+		if got := profile.FaceToReaction(tt.id); got != tt.want {
+			t.Errorf("FaceToReaction(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestReactionToFace(t *testing.T) {
+	profile := ProfileFor(AgentNapCat)
+
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{"/微笑", "14", true},
+		{"微笑", "14", true},
+		{"👍", "128077", true},
+		{"👍️", "128077", true},
+		{"/[Face9999999]", "9999999", true},
+		{"/[Faceabc]", "", false},
+		{"/unknown", "", false},
+		{"ok", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := profile.ReactionToFace(tt.key)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ReactionToFace(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestFaceReactionRoundTrip(t *testing.T) {
+	profile := ProfileFor(AgentNapCat)
+
+	for id := range qqEmoji {
+		key := profile.FaceToReaction(id)
+		if got, ok := profile.ReactionToFace(key); !ok || got != id {
+			// Several IDs may share a name, the reverse lookup only has to land on one of them
+			if qqEmoji[got] != qqEmoji[id] {
+				t.Errorf("ReactionToFace(FaceToReaction(%q)) = %q, %v", id, got, ok)
+			}
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package onebot
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const mediaPathPrefix = "/media/"
+
+type MediaMode string
+
+const (
+	// Inline the media as base64:// in the request
+	MediaBase64 MediaMode = "base64"
+	// Serve the media from the service with a short-lived URL
+	MediaHTTP MediaMode = "http"
+	// Write the media to a directory shared with the agent
+	MediaFile MediaMode = "file"
+)
+
+type MediaConfig struct {
+	Mode MediaMode
+	// Base URL of the service as seen by the agent, used by MediaHTTP
+	PublicURL string
+	// Directory to write media to, and where the agent sees it, used by MediaFile
+	Directory      string
+	AgentDirectory string
+	// How long media stays available
+	TTL time.Duration
+}
+
+type mediaEntry struct {
+	name  string
+	path  string
+	token string
+}
+
+type mediaStore struct {
+	config MediaConfig
+	// Where files are written, the shared directory or a spool directory for MediaHTTP
+	directory string
+
+	entries     map[string]*mediaEntry
+	entriesLock sync.RWMutex
+	lastSweep   time.Time
+}
+
+func newMediaStore(log zerolog.Logger, config MediaConfig) *mediaStore {
+	if config.TTL <= 0 {
+		config.TTL = 5 * time.Minute
+	}
+
+	directory := config.Directory
+	if config.Mode == MediaHTTP && directory == "" {
+		directory = filepath.Join(os.TempDir(), "pylon-media")
+	}
+
+	m := &mediaStore{
+		config:    config,
+		directory: directory,
+		entries:   make(map[string]*mediaEntry),
+	}
+	// Files of a previous run are never cleaned up otherwise
+	if directory != "" && (config.Mode == MediaHTTP || config.Mode == MediaFile) {
+		if err := m.sweep(); err != nil {
+			log.Warn().Err(err).Str("directory", directory).Msg("Failed to sweep media directory")
+		}
+	}
+	return m
+}
+
+// put writes the data to the media directory, see putFile
+func (m *mediaStore) put(data []byte, name string) (string, error) {
+	return m.store(name, func(dst *os.File) error {
+		_, err := dst.Write(data)
+		return err
+	})
+}
+
+// putFile copies a file to the media directory and returns the file URI for segments,
+// the file is streamed so that large media isn't held in memory
+func (m *mediaStore) putFile(src, name string) (string, error) {
+	return m.store(name, func(dst *os.File) error {
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(dst, f)
+		return err
+	})
+}
+
+func (m *mediaStore) store(name string, write func(*os.File) error) (string, error) {
+	switch m.config.Mode {
+	case MediaHTTP:
+		if m.config.PublicURL == "" {
+			return "", fmt.Errorf("media public URL is not configured")
+		}
+	case MediaFile:
+		if m.config.Directory == "" {
+			return "", fmt.Errorf("media directory is not configured")
+		}
+	default:
+		return "", fmt.Errorf("unsupported media mode %s", m.config.Mode)
+	}
+
+	m.sweepPeriodically()
+
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(m.directory, 0755); err != nil {
+		return "", err
+	}
+	fileName := id + filepath.Ext(name)
+	localPath := filepath.Join(m.directory, fileName)
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(localPath)
+		return "", err
+	}
+
+	if m.config.Mode == MediaFile {
+		agentDir := m.config.AgentDirectory
+		if agentDir == "" {
+			agentDir = m.config.Directory
+		}
+		return "file://" + path.Join(filepath.ToSlash(agentDir), fileName), nil
+	}
+
+	// URLs end up in agent and proxy logs, so they carry a token that only grants access to this file
+	token, err := randomID()
+	if err != nil {
+		os.Remove(localPath)
+		return "", err
+	}
+
+	m.entriesLock.Lock()
+	m.entries[id] = &mediaEntry{name: name, path: localPath, token: token}
+	m.entriesLock.Unlock()
+
+	return fmt.Sprintf("%s%s%s/%s?token=%s",
+		strings.TrimSuffix(m.config.PublicURL, "/"), mediaPathPrefix, id, url.PathEscape(name), token), nil
+}
+
+// sweepPeriodically sweeps at most once per TTL, there is no need for a timer per file
+func (m *mediaStore) sweepPeriodically() {
+	m.entriesLock.Lock()
+	due := time.Since(m.lastSweep) > m.config.TTL
+	if due {
+		m.lastSweep = time.Now()
+	}
+	m.entriesLock.Unlock()
+
+	if due {
+		go m.sweep()
+	}
+}
+
+// sweep removes media older than the TTL, only files named like the ones written here are touched
+func (m *mediaStore) sweep() error {
+	files, err := os.ReadDir(m.directory)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		id := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		if file.IsDir() || !isMediaID(id) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil || time.Since(info.ModTime()) < m.config.TTL {
+			continue
+		}
+
+		os.Remove(filepath.Join(m.directory, file.Name()))
+		m.entriesLock.Lock()
+		delete(m.entries, id)
+		m.entriesLock.Unlock()
+	}
+	return nil
+}
+
+func (m *mediaStore) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	id, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, mediaPathPrefix), "/")
+
+	m.entriesLock.RLock()
+	entry, ok := m.entries[id]
+	m.entriesLock.RUnlock()
+	if !ok {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+
+	if token := r.URL.Query().Get("token"); token == "" || !hmac.Equal([]byte(token), []byte(entry.token)) {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	f, err := os.Open(entry.path)
+	if err != nil {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || time.Since(info.ModTime()) > m.config.TTL {
+		http.Error(w, "Media expired", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(entry.name)))
+	http.ServeContent(w, r, entry.name, info.ModTime(), f)
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func isMediaID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func (c *Client) useMediaStore() bool {
+	// The WeChat agent only understands inline media
+	return c.GetAgentType() != AgentWeChat && c.service != nil && c.service.media.config.Mode != MediaBase64 && c.service.media.config.Mode != ""
+}
+
+// MediaURI returns a file URI the agent can fetch the data from,
+// falling back to base64:// if the agent or configuration doesn't allow anything better
+func (c *Client) MediaURI(data []byte, name string) string {
+	if c.useMediaStore() {
+		if uri, err := c.service.media.put(data, name); err == nil {
+			return uri
+		} else {
+			c.log.Warn().Err(err).Msg("Failed to serve media, falling back to base64")
+		}
+	}
+
+	return "base64://" + base64.StdEncoding.EncodeToString(data)
+}
+
+// MediaFileURI is MediaURI for media in a file, which is only read into memory for base64
+func (c *Client) MediaFileURI(path, name string) (string, error) {
+	if c.useMediaStore() {
+		if uri, err := c.service.media.putFile(path, name); err == nil {
+			return uri, nil
+		} else {
+			c.log.Warn().Err(err).Msg("Failed to serve media, falling back to base64")
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return "base64://" + base64.StdEncoding.EncodeToString(data), nil
+}
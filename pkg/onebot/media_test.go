@@ -0,0 +1,55 @@
+package onebot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestMediaURLHasEntryToken(t *testing.T) {
+	m := newMediaStore(zerolog.Nop(), MediaConfig{
+		Mode:      MediaHTTP,
+		PublicURL: "http://pylon",
+		Directory: t.TempDir(),
+		TTL:       time.Minute,
+	})
+
+	uri, err := m.put([]byte("data"), "a.txt")
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	mediaURL, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("invalid media URL %q: %v", uri, err)
+	}
+	token := mediaURL.Query().Get("token")
+	if token == "" || mediaURL.Query().Has("access_token") {
+		t.Fatalf("media URL %q doesn't carry only an entry token", uri)
+	}
+	other, _ := m.put([]byte("data"), "b.txt")
+	if strings.Contains(other, token) {
+		t.Fatal("entries share a token")
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"token=" + token, http.StatusOK},
+		{"token=wrong", http.StatusUnauthorized},
+		{"access_token=" + token, http.StatusUnauthorized},
+		{"", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		m.serveHTTP(w, httptest.NewRequest(http.MethodGet, mediaURL.Path+"?"+tt.query, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET with %q = %d, want %d", tt.query, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package onebot
+
+import "time"
+
+// API is what the bridge needs from a network backend. The OneBot 11 events and segments
+// of this package are the shared model: Client speaks OneBot natively, other backends
+// (e.g. satori.Client) translate to and from it.
+type API interface {
+	Start(mode TransportMode, endpoint string)
+	Release()
+	SetEventHandler(handler func(IEvent))
+	SetStatusHandler(handler func(ClientStatus))
+	GetStatus() ClientStatus
+	IsLoggedIn() bool
+	IsReconnecting() bool
+	GetToken() string
+	GetAgentType() AgentType
+	GetProfile() AgentProfile
+	GetAgentInfo() AgentInfo
+
+	GetLoginInfo() (*UserInfo, error)
+	GetUserInfo(userID string) (*UserInfo, error)
+	GetGroupInfo(groupID string) (*GroupInfo, error)
+	GetFriendList() ([]*UserInfo, error)
+	GetGroupList() ([]*GroupInfo, error)
+	GetGroupMemberList(groupID string) ([]*MemberInfo, error)
+	GetGroupMemberInfo(groupID string, userID string) (*MemberInfo, error)
+
+	SendPrivateMessage(userID string, segments []ISegment) (*SendMessageResponse, error)
+	SendGroupMessage(groupID string, segments []ISegment) (*SendMessageResponse, error)
+	SendPrivateForwardMessage(userID string, nodes []ISegment) (*SendMessageResponse, error)
+	SendGroupForwardMessage(groupID string, nodes []ISegment) (*SendMessageResponse, error)
+	SendForwardMessage(messageType, targetID string, nodes []ISegment) (*SendMessageResponse, error)
+	GetMessage(messageID string) (*Message, error)
+	GetGroupMsgHistory(groupID, messageSeq string, count int) ([]*Message, error)
+	GetFriendMsgHistory(userID, messageSeq string, count int) ([]*Message, error)
+	GetForwardMessage(messageID string) ([]*Message, error)
+	DeleteMessage(messageID string) error
+	MarkMsgAsRead(messageID string) error
+	MarkPrivateMsgAsRead(userID string) error
+	MarkGroupMsgAsRead(groupID string) error
+	SetMsgEmojiLike(messageID, emojiID string, set bool) error
+
+	SetFriendAddRequest(flag string, approve bool) error
+	SetGroupAddRequest(flag, subType string, approve bool, reason string) error
+	SetGroupKick(groupID, userID string, rejectAddRequest bool) error
+	SetGroupLeave(groupID string) error
+	SetGroupName(groupID, name string) error
+	SetGroupCard(groupID, userID, card string) error
+	SetGroupPortrait(groupID, file string) error
+	SetGroupAdmin(groupID, userID string, enable bool) error
+	SetGroupBan(groupID, userID string, duration time.Duration) error
+	SetGroupWholeBan(groupID string, enable bool) error
+	GroupPoke(groupID, userID string) error
+	FriendPoke(userID string) error
+
+	UploadGroupFile(groupID, file, name string) error
+	UploadPrivateFile(userID, file, name string) error
+	DownloadMedia(seg ISegment) (string, []byte, error)
+	MediaURI(data []byte, name string) string
+	MediaFileURI(path, name string) (string, error)
+}
+
+var _ API = (*Client)(nil)
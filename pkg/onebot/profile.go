@@ -0,0 +1,257 @@
+package onebot
+
+import (
+	"fmt"
+
+	"github.com/duo/matrix-pylon/pkg/util"
+)
+
+// AgentProfile describes what differs between agent implementations: the network behind them,
+// how avatars and faces are resolved, how locations are sent and what they support
+type AgentProfile interface {
+	Type() AgentType
+
+	// UserAvatarURL and GroupAvatarURL resolve an avatar, reported is what the agent returned (if anything)
+	UserAvatarURL(userID, reported string) string
+	GroupAvatarURL(groupID, reported string) string
+
+	// FaceText renders a face segment as text
+	FaceText(id string) string
+	// ConvertText replaces the emoji codes of the network in text
+	ConvertText(content string) string
+	// FaceToReaction and ReactionToFace map between face IDs and Matrix reaction keys
+	FaceToReaction(id string) string
+	ReactionToFace(key string) (string, bool)
+
+	LocationSegments(name string, lat, lng float64) []ISegment
+	// VoiceFormat is the audio format records are sent in, empty if the agent converts them itself
+	VoiceFormat() string
+
+	SupportsSegment(segType SegmentType) bool
+	SupportsAction(action RequestType) bool
+}
+
+// Actions every OneBot 11 agent is expected to implement
+var standardActions = []RequestType{
+	SendPrivateMsg, SendGroupMsg, SendMsg, DeleteMsg, GetMsg,
+	GetLoginInfo, GetStrangerInfo, GetFriendList, GetGroupInfo, GetGroupList,
+	GetGroupMemberInfo, GetGroupMemberList, GetStatus, GetVersionInfo,
+}
+
+func newSet[T comparable](groups ...[]T) map[T]struct{} {
+	set := make(map[T]struct{})
+	for _, group := range groups {
+		for _, item := range group {
+			set[item] = struct{}{}
+		}
+	}
+	return set
+}
+
+// qqProfile is shared by the QQ agents
+type qqProfile struct {
+	agentType AgentType
+	segments  map[SegmentType]struct{}
+	actions   map[RequestType]struct{}
+}
+
+var qqSegments = []SegmentType{
+	Text, Face, MarketFace, Image, Record, Video, File, At, Share, Contact,
+	Location, Music, LightAPP, Reply, Forward, Node, XML, JSON,
+}
+
+var qqGroupActions = []RequestType{
+	SetGroupKick, SetGroupBan, SetGroupWholeBan, SetGroupAdmin, SetGroupCard, SetGroupName,
+	SetGroupLeave, SetFriendAddRequest, SetGroupAddRequest, SetGroupPortrait,
+	GetRecord, GetImage, GetForwardMsg, GetGroupMsgHistory, UploadGroupFile, UploadPrivateFile,
+}
+
+var napCatProfile AgentProfile = &qqProfile{
+	agentType: AgentNapCat,
+	segments:  newSet(qqSegments),
+	actions: newSet(standardActions, qqGroupActions, []RequestType{
+		GetFile, SendForwardMsg, MarkPrivateMsgAsRead, MarkGroupMsgAsRead,
+		GetFriendMsgHistory, SetMsgEmojiLike, GroupPoke, FriendPoke,
+	}),
+}
+
+var llOneBotProfile AgentProfile = &qqProfile{
+	agentType: AgentLLOneBot,
+	segments:  newSet(qqSegments),
+	actions: newSet(standardActions, qqGroupActions, []RequestType{
+		GetFile, SendGroupForwardMsg, SendPrivateForwardMsg, MarkMsgAsRead,
+		GetFriendMsgHistory, SetMsgEmojiLike, GroupPoke, FriendPoke, SendPoke,
+	}),
+}
+
+func (p *qqProfile) Type() AgentType {
+	return p.agentType
+}
+
+func (p *qqProfile) UserAvatarURL(userID, reported string) string {
+	return util.GetUserAvatarURL(userID)
+}
+
+func (p *qqProfile) GroupAvatarURL(groupID, reported string) string {
+	return util.GetGroupAvatarURL(groupID)
+}
+
+func (p *qqProfile) FaceText(id string) string {
+	if v, ok := qqEmoji[id]; ok {
+		return fmt.Sprintf("/%s", v)
+	}
+	return fmt.Sprintf("/[Face%s]", id)
+}
+
+func (p *qqProfile) ConvertText(content string) string {
+	return content
+}
+
+func (p *qqProfile) FaceToReaction(id string) string {
+	return faceToReaction(qqEmoji, id)
+}
+
+func (p *qqProfile) ReactionToFace(key string) (string, bool) {
+	return reactionToFace(key)
+}
+
+// LocationSegments sends a map card, QQ doesn't display plain location segments
+func (p *qqProfile) LocationSegments(name string, lat, lng float64) []ISegment {
+	locationJson := fmt.Sprintf(`
+		{
+			"app": "com.tencent.map",
+			"desc": "地图",
+			"view": "LocationShare",
+			"ver": "0.0.0.1",
+			"prompt": "[位置]%s",
+			"from": 1,
+			"meta": {
+			  "Location.Search": {
+				"id": "12250896297164027526",
+				"name": "%s",
+				"address": "%s",
+				"lat": "%.5f",
+				"lng": "%.5f",
+				"from": "plusPanel"
+			  }
+			},
+			"config": {
+			  "forward": 1,
+			  "autosize": 1,
+			  "type": "card"
+			}
+		}
+		`, name, name, name, lat, lng)
+
+	return []ISegment{NewJSON(locationJson)}
+}
+
+// VoiceFormat is AMR, which QQ plays without the agent having to encode SILK
+func (p *qqProfile) VoiceFormat() string {
+	return "amr"
+}
+
+func (p *qqProfile) SupportsSegment(segType SegmentType) bool {
+	_, ok := p.segments[segType]
+	return ok
+}
+
+func (p *qqProfile) SupportsAction(action RequestType) bool {
+	_, ok := p.actions[action]
+	return ok
+}
+
+// genericProfile assumes nothing about the network, avatars are whatever the agent reports
+type genericProfile struct {
+	agentType AgentType
+	segments  map[SegmentType]struct{}
+	actions   map[RequestType]struct{}
+	// Replaces emoji codes in text, if the network has any
+	emoji interface{ Replace(string) string }
+}
+
+// ComWeChat and wxbot-style agents only handle the basic segments, without replies or QQ faces
+var weChatProfile AgentProfile = &genericProfile{
+	agentType: AgentWeChat,
+	segments:  newSet([]SegmentType{Text, At, Image, Video, File}),
+	actions: newSet(standardActions, []RequestType{
+		GetImage, GetFile, SetFriendAddRequest, SetGroupAddRequest,
+	}),
+	emoji: wechatEmoji,
+}
+
+var satoriProfile AgentProfile = &genericProfile{
+	agentType: AgentSatori,
+	segments:  newSet([]SegmentType{Text, Face, Image, Record, Video, File, At, Location, Reply}),
+	actions: newSet(standardActions, []RequestType{
+		GetGroupMsgHistory, GetFriendMsgHistory, SetMsgEmojiLike, SetFriendAddRequest,
+		SetGroupAddRequest, SetGroupKick, SetGroupBan, SetGroupName, UploadGroupFile, UploadPrivateFile,
+	}),
+}
+
+func (p *genericProfile) Type() AgentType {
+	return p.agentType
+}
+
+func (p *genericProfile) UserAvatarURL(userID, reported string) string {
+	return reported
+}
+
+func (p *genericProfile) GroupAvatarURL(groupID, reported string) string {
+	return reported
+}
+
+func (p *genericProfile) FaceText(id string) string {
+	return fmt.Sprintf("/[Face%s]", id)
+}
+
+func (p *genericProfile) ConvertText(content string) string {
+	if p.emoji != nil {
+		return p.emoji.Replace(content)
+	}
+	return content
+}
+
+func (p *genericProfile) FaceToReaction(id string) string {
+	return faceToReaction(nil, id)
+}
+
+func (p *genericProfile) ReactionToFace(key string) (string, bool) {
+	return reactionToFace(key)
+}
+
+func (p *genericProfile) LocationSegments(name string, lat, lng float64) []ISegment {
+	return []ISegment{NewLocation(lat, lng, name, name)}
+}
+
+func (p *genericProfile) VoiceFormat() string {
+	return ""
+}
+
+func (p *genericProfile) SupportsSegment(segType SegmentType) bool {
+	_, ok := p.segments[segType]
+	return ok
+}
+
+func (p *genericProfile) SupportsAction(action RequestType) bool {
+	_, ok := p.actions[action]
+	return ok
+}
+
+// ProfileFor returns the profile of an agent type
+func ProfileFor(agentType AgentType) AgentProfile {
+	switch agentType {
+	case AgentLLOneBot:
+		return llOneBotProfile
+	case AgentWeChat:
+		return weChatProfile
+	case AgentSatori:
+		return satoriProfile
+	default:
+		return napCatProfile
+	}
+}
+
+func (c *Client) GetProfile() AgentProfile {
+	return ProfileFor(c.GetAgentType())
+}
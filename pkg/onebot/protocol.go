@@ -68,6 +68,8 @@ const (
 	SendPrivateForwardMsg RequestType = "send_private_forward_msg"
 	GetGroupMsgHistory    RequestType = "get_group_msg_history"
 	UploadGroupFile       RequestType = "upload_group_file"
+	UploadPrivateFile     RequestType = "upload_private_file"
+	SetGroupPortrait      RequestType = "set_group_portrait"
 	DownloadFile          RequestType = "download_file"
 
 	// NapCat
@@ -76,8 +78,12 @@ const (
 	ForwardGroupSingleMsg  RequestType = "forward_group_single_msg"
 	SendForwardMsg         RequestType = "send_forward_msg"
 	MarkPrivateMsgAsRead   RequestType = "mark_private_msg_as_read"
-	MarkGroupMsgAsRead     RequestType = "mark_private_msg_as_read"
+	MarkGroupMsgAsRead     RequestType = "mark_group_msg_as_read"
 	GetFriendMsgHistory    RequestType = "get_friend_msg_history"
+	SetMsgEmojiLike        RequestType = "set_msg_emoji_like"
+	GroupPoke              RequestType = "group_poke"
+	FriendPoke             RequestType = "friend_poke"
+	SendPoke               RequestType = "send_poke"
 )
 
 type Request struct {
@@ -180,6 +186,15 @@ func NewGetFileRequest(fileID string) *Request {
 	}
 }
 
+func NewGetMsgRequest(msgID string) *Request {
+	return &Request{
+		Action: string(GetMsg),
+		Params: map[string]interface{}{
+			"message_id": msgID,
+		},
+	}
+}
+
 func NewGetForwardMsgRequest(msgID string) *Request {
 	return &Request{
 		Action: string(GetForwardMsg),
@@ -189,6 +204,38 @@ func NewGetForwardMsgRequest(msgID string) *Request {
 	}
 }
 
+func NewGetGroupMsgHistoryRequest(groupID, messageSeq string, count int) *Request {
+	params := map[string]interface{}{
+		"group_id": groupID,
+		"count":    count,
+	}
+	// Without message_seq the latest messages are returned
+	if messageSeq != "" {
+		params["message_seq"] = messageSeq
+	}
+
+	return &Request{
+		Action: string(GetGroupMsgHistory),
+		Params: params,
+	}
+}
+
+func NewGetFriendMsgHistoryRequest(userID, messageSeq string, count int) *Request {
+	params := map[string]interface{}{
+		"user_id": userID,
+		"count":   count,
+	}
+	// Without message_seq the latest messages are returned
+	if messageSeq != "" {
+		params["message_seq"] = messageSeq
+	}
+
+	return &Request{
+		Action: string(GetFriendMsgHistory),
+		Params: params,
+	}
+}
+
 func NewPrivateMsgRequest(userID string, segments []ISegment) *Request {
 	return &Request{
 		Action: string(SendMsg),
@@ -211,6 +258,149 @@ func NewGroupMsgRequest(groupID string, segments []ISegment) *Request {
 	}
 }
 
+func NewPrivateForwardMsgRequest(userID string, nodes []ISegment) *Request {
+	return &Request{
+		Action: string(SendPrivateForwardMsg),
+		Params: map[string]interface{}{
+			"user_id":  userID,
+			"messages": nodes,
+		},
+	}
+}
+
+func NewGroupForwardMsgRequest(groupID string, nodes []ISegment) *Request {
+	return &Request{
+		Action: string(SendGroupForwardMsg),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+			"messages": nodes,
+		},
+	}
+}
+
+func NewForwardMsgRequest(messageType, targetID string, nodes []ISegment) *Request {
+	params := map[string]interface{}{
+		"message_type": messageType,
+		"messages":     nodes,
+	}
+	if messageType == "group" {
+		params["group_id"] = targetID
+	} else {
+		params["user_id"] = targetID
+	}
+
+	return &Request{
+		Action: string(SendForwardMsg),
+		Params: params,
+	}
+}
+
+func NewSetFriendAddRequestRequest(flag string, approve bool) *Request {
+	return &Request{
+		Action: string(SetFriendAddRequest),
+		Params: map[string]interface{}{
+			"flag":    flag,
+			"approve": approve,
+		},
+	}
+}
+
+func NewSetGroupAddRequestRequest(flag, subType string, approve bool, reason string) *Request {
+	return &Request{
+		Action: string(SetGroupAddRequest),
+		Params: map[string]interface{}{
+			"flag":     flag,
+			"sub_type": subType,
+			"type":     subType,
+			"approve":  approve,
+			"reason":   reason,
+		},
+	}
+}
+
+func NewSetGroupKickRequest(groupID, userID string, rejectAddRequest bool) *Request {
+	return &Request{
+		Action: string(SetGroupKick),
+		Params: map[string]interface{}{
+			"group_id":           groupID,
+			"user_id":            userID,
+			"reject_add_request": rejectAddRequest,
+		},
+	}
+}
+
+func NewSetGroupLeaveRequest(groupID string) *Request {
+	return &Request{
+		Action: string(SetGroupLeave),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+		},
+	}
+}
+
+func NewSetGroupNameRequest(groupID, name string) *Request {
+	return &Request{
+		Action: string(SetGroupName),
+		Params: map[string]interface{}{
+			"group_id":   groupID,
+			"group_name": name,
+		},
+	}
+}
+
+func NewSetGroupCardRequest(groupID, userID, card string) *Request {
+	return &Request{
+		Action: string(SetGroupCard),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+			"user_id":  userID,
+			"card":     card,
+		},
+	}
+}
+
+func NewSetGroupPortraitRequest(groupID, file string) *Request {
+	return &Request{
+		Action: string(SetGroupPortrait),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+			"file":     file,
+		},
+	}
+}
+
+func NewSetGroupAdminRequest(groupID, userID string, enable bool) *Request {
+	return &Request{
+		Action: string(SetGroupAdmin),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+			"user_id":  userID,
+			"enable":   enable,
+		},
+	}
+}
+
+func NewSetGroupBanRequest(groupID, userID string, duration int64) *Request {
+	return &Request{
+		Action: string(SetGroupBan),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+			"user_id":  userID,
+			"duration": duration,
+		},
+	}
+}
+
+func NewSetGroupWholeBanRequest(groupID string, enable bool) *Request {
+	return &Request{
+		Action: string(SetGroupWholeBan),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+			"enable":   enable,
+		},
+	}
+}
+
 func NewDeleteMsgRequest(messageID string) *Request {
 	return &Request{
 		Action: string(DeleteMsg),
@@ -220,6 +410,112 @@ func NewDeleteMsgRequest(messageID string) *Request {
 	}
 }
 
+func NewSetMsgEmojiLikeRequest(messageID, emojiID string, set bool) *Request {
+	return &Request{
+		Action: string(SetMsgEmojiLike),
+		Params: map[string]interface{}{
+			"message_id": messageID,
+			"emoji_id":   emojiID,
+			"set":        set,
+		},
+	}
+}
+
+func NewGroupPokeRequest(groupID, userID string) *Request {
+	return &Request{
+		Action: string(GroupPoke),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+			"user_id":  userID,
+		},
+	}
+}
+
+func NewFriendPokeRequest(userID string) *Request {
+	return &Request{
+		Action: string(FriendPoke),
+		Params: map[string]interface{}{
+			"user_id": userID,
+		},
+	}
+}
+
+// NewSendPokeRequest pokes in a group, or in private if groupID is empty
+func NewSendPokeRequest(groupID, userID string) *Request {
+	params := map[string]interface{}{
+		"user_id": userID,
+	}
+	if groupID != "" {
+		params["group_id"] = groupID
+	}
+
+	return &Request{
+		Action: string(SendPoke),
+		Params: params,
+	}
+}
+
+func NewUploadGroupFileRequest(groupID, file, name string) *Request {
+	return &Request{
+		Action: string(UploadGroupFile),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+			"file":     file,
+			"name":     name,
+		},
+	}
+}
+
+func NewUploadPrivateFileRequest(userID, file, name string) *Request {
+	return &Request{
+		Action: string(UploadPrivateFile),
+		Params: map[string]interface{}{
+			"user_id": userID,
+			"file":    file,
+			"name":    name,
+		},
+	}
+}
+
+func NewMarkMsgAsReadRequest(messageID string) *Request {
+	return &Request{
+		Action: string(MarkMsgAsRead),
+		Params: map[string]interface{}{
+			"message_id": messageID,
+		},
+	}
+}
+
+func NewMarkPrivateMsgAsReadRequest(userID string) *Request {
+	return &Request{
+		Action: string(MarkPrivateMsgAsRead),
+		Params: map[string]interface{}{
+			"user_id": userID,
+		},
+	}
+}
+
+func NewMarkGroupMsgAsReadRequest(groupID string) *Request {
+	return &Request{
+		Action: string(MarkGroupMsgAsRead),
+		Params: map[string]interface{}{
+			"group_id": groupID,
+		},
+	}
+}
+
+func NewGetVersionInfoRequest() *Request {
+	return &Request{Action: string(GetVersionInfo)}
+}
+
+func NewCanSendImageRequest() *Request {
+	return &Request{Action: string(CanSendImage)}
+}
+
+func NewCanSendRecordRequest() *Request {
+	return &Request{Action: string(CanSendRecord)}
+}
+
 type Response struct {
 	Status  string `json:"status"`
 	Retcode int32  `json:"retcode"`
@@ -251,6 +547,8 @@ type MemberInfo struct {
 	Card     string `json:"card,omitempty" mapstructure:"card,omitempty"`
 	Role     string `json:"role,omitempty" mapstructure:"role,omitempty"`
 	Avatar   string `json:"avatar,omitempty" mapstructure:"avatar,omitempty"`
+
+	ShutUpTimestamp int64 `json:"shut_up_timestamp,omitempty" mapstructure:"shut_up_timestamp,omitempty"`
 }
 
 type FileInfo struct {
@@ -266,6 +564,16 @@ type SendMessageResponse struct {
 	MessageID string `json:"message_id" mapstructure:"message_id"`
 }
 
+type VersionInfo struct {
+	AppName         string `json:"app_name" mapstructure:"app_name"`
+	AppVersion      string `json:"app_version,omitempty" mapstructure:"app_version,omitempty"`
+	ProtocolVersion string `json:"protocol_version,omitempty" mapstructure:"protocol_version,omitempty"`
+}
+
+type YesResponse struct {
+	Yes bool `json:"yes" mapstructure:"yes"`
+}
+
 type EventType string
 
 const (
@@ -290,6 +598,7 @@ const (
 	NoticeNotifyPoke           EventType = "notice_notify_poke"
 	NoticeNotifyLuckyKing      EventType = "notice_notify_lucky_king"
 	NoticeNotifyHonnor         EventType = "notice_notify_honnor"
+	NoticeGroupMsgEmojiLike    EventType = "notice_group_msg_emoji_like"
 	RequestFriend              EventType = "request_friend"
 	RequestGroupAdd            EventType = "request_group_add"
 	RequestGroupInvite         EventType = "request_group_invite"
@@ -304,6 +613,8 @@ type Event struct {
 	Time     int64  `json:"time" mapstructure:"time"`
 	SelfID   string `json:"self_id" mapstructure:"self_id"`
 	PostType string `json:"post_type" mapstructure:"post_type"`
+	// Only sent by OneBot 12 agents
+	Platform string `json:"platform,omitempty" mapstructure:"platform,omitempty"`
 }
 
 func (e *Event) PayloadType() PayloadType {
@@ -403,6 +714,198 @@ func (g *FriendRecall) EventType() EventType {
 	return NoticeFriendRecall
 }
 
+type GroupIncrease struct {
+	Event      `mapstructure:",squash"`
+	NoticeType string `json:"notice_type" mapstructure:"notice_type"`
+	SubType    string `json:"sub_type" mapstructure:"sub_type"`
+	GroupID    string `json:"group_id" mapstructure:"group_id"`
+	OperatorID string `json:"operator_id" mapstructure:"operator_id"`
+	UserID     string `json:"user_id" mapstructure:"user_id"`
+}
+
+func (g *GroupIncrease) EventType() EventType {
+	if g.SubType == "invite" {
+		return NoticeGroupIncreaseInvite
+	}
+	return NoticeGroupIncreaseApprove
+}
+
+type GroupDecrease struct {
+	Event      `mapstructure:",squash"`
+	NoticeType string `json:"notice_type" mapstructure:"notice_type"`
+	SubType    string `json:"sub_type" mapstructure:"sub_type"`
+	GroupID    string `json:"group_id" mapstructure:"group_id"`
+	OperatorID string `json:"operator_id" mapstructure:"operator_id"`
+	UserID     string `json:"user_id" mapstructure:"user_id"`
+}
+
+func (g *GroupDecrease) EventType() EventType {
+	switch g.SubType {
+	case "kick":
+		return NoticeGroupDecreaseKick
+	case "kick_me":
+		return NoticeGroupDecreaseKickMe
+	}
+	return NoticeGroupDecreaseleave
+}
+
+type GroupAdmin struct {
+	Event      `mapstructure:",squash"`
+	NoticeType string `json:"notice_type" mapstructure:"notice_type"`
+	SubType    string `json:"sub_type" mapstructure:"sub_type"`
+	GroupID    string `json:"group_id" mapstructure:"group_id"`
+	UserID     string `json:"user_id" mapstructure:"user_id"`
+}
+
+func (g *GroupAdmin) EventType() EventType {
+	if g.SubType == "unset" {
+		return NoticeGroupAdminUnset
+	}
+	return NoticeGroupAdminSet
+}
+
+type GroupBan struct {
+	Event      `mapstructure:",squash"`
+	NoticeType string `json:"notice_type" mapstructure:"notice_type"`
+	SubType    string `json:"sub_type" mapstructure:"sub_type"`
+	GroupID    string `json:"group_id" mapstructure:"group_id"`
+	OperatorID string `json:"operator_id" mapstructure:"operator_id"`
+	UserID     string `json:"user_id" mapstructure:"user_id"`
+	Duration   int64  `json:"duration" mapstructure:"duration"`
+}
+
+func (g *GroupBan) EventType() EventType {
+	if g.SubType == "lift_ban" {
+		return NoticeGroupBanLiftBan
+	}
+	return NoticeGroupBanBan
+}
+
+// IsWholeBan reports whether the notice mutes or unmutes the whole group
+func (g *GroupBan) IsWholeBan() bool {
+	return g.UserID == "" || g.UserID == "0"
+}
+
+type UploadedFile struct {
+	ID    string `json:"id" mapstructure:"id"`
+	Name  string `json:"name" mapstructure:"name"`
+	Size  int64  `json:"size" mapstructure:"size"`
+	BusID int64  `json:"busid,omitempty" mapstructure:"busid,omitempty"`
+	URL   string `json:"url,omitempty" mapstructure:"url,omitempty"`
+}
+
+// Segment wraps the file in a segment, so it can be fetched with DownloadMedia
+func (f *UploadedFile) Segment() *FileSegment {
+	seg := NewFile(f.ID, f.Name)
+	if f.URL != "" {
+		seg.Data["url"] = f.URL
+	}
+	return seg
+}
+
+type GroupUpload struct {
+	Event      `mapstructure:",squash"`
+	NoticeType string       `json:"notice_type" mapstructure:"notice_type"`
+	GroupID    string       `json:"group_id" mapstructure:"group_id"`
+	UserID     string       `json:"user_id" mapstructure:"user_id"`
+	File       UploadedFile `json:"file" mapstructure:"file"`
+}
+
+func (g *GroupUpload) EventType() EventType {
+	return NoticeGroupUpload
+}
+
+type OfflineFile struct {
+	Event      `mapstructure:",squash"`
+	NoticeType string       `json:"notice_type" mapstructure:"notice_type"`
+	UserID     string       `json:"user_id" mapstructure:"user_id"`
+	File       UploadedFile `json:"file" mapstructure:"file"`
+}
+
+func (o *OfflineFile) EventType() EventType {
+	return NoticeOfflineFile
+}
+
+type Poke struct {
+	Event      `mapstructure:",squash"`
+	NoticeType string `json:"notice_type" mapstructure:"notice_type"`
+	SubType    string `json:"sub_type" mapstructure:"sub_type"`
+	GroupID    string `json:"group_id,omitempty" mapstructure:"group_id,omitempty"`
+	UserID     string `json:"user_id" mapstructure:"user_id"`
+	SenderID   string `json:"sender_id,omitempty" mapstructure:"sender_id,omitempty"`
+	TargetID   string `json:"target_id" mapstructure:"target_id"`
+}
+
+func (p *Poke) EventType() EventType {
+	return NoticeNotifyPoke
+}
+
+// Sender returns who poked, group pokes only carry it in user_id
+func (p *Poke) Sender() string {
+	if p.SenderID == "" || p.SenderID == "0" {
+		return p.UserID
+	}
+	return p.SenderID
+}
+
+// IsGroup reports whether the poke happened in a group
+func (p *Poke) IsGroup() bool {
+	return p.GroupID != "" && p.GroupID != "0"
+}
+
+type EmojiLike struct {
+	EmojiID string `json:"emoji_id" mapstructure:"emoji_id"`
+	Count   int    `json:"count" mapstructure:"count"`
+}
+
+type GroupMsgEmojiLike struct {
+	Event      `mapstructure:",squash"`
+	NoticeType string      `json:"notice_type" mapstructure:"notice_type"`
+	GroupID    string      `json:"group_id" mapstructure:"group_id"`
+	UserID     string      `json:"user_id" mapstructure:"user_id"`
+	MessageID  string      `json:"message_id" mapstructure:"message_id"`
+	Likes      []EmojiLike `json:"likes" mapstructure:"likes"`
+	IsAdd      *bool       `json:"is_add,omitempty" mapstructure:"is_add,omitempty"`
+}
+
+func (g *GroupMsgEmojiLike) EventType() EventType {
+	return NoticeGroupMsgEmojiLike
+}
+
+// Added reports whether the emoji was added, older NapCat versions only notify additions
+func (g *GroupMsgEmojiLike) Added() bool {
+	return g.IsAdd == nil || *g.IsAdd
+}
+
+type FriendRequest struct {
+	Event       `mapstructure:",squash"`
+	RequestType string `json:"request_type" mapstructure:"request_type"`
+	UserID      string `json:"user_id" mapstructure:"user_id"`
+	Comment     string `json:"comment" mapstructure:"comment"`
+	Flag        string `json:"flag" mapstructure:"flag"`
+}
+
+func (f *FriendRequest) EventType() EventType {
+	return RequestFriend
+}
+
+type GroupRequest struct {
+	Event       `mapstructure:",squash"`
+	RequestType string `json:"request_type" mapstructure:"request_type"`
+	SubType     string `json:"sub_type" mapstructure:"sub_type"`
+	GroupID     string `json:"group_id" mapstructure:"group_id"`
+	UserID      string `json:"user_id" mapstructure:"user_id"`
+	Comment     string `json:"comment" mapstructure:"comment"`
+	Flag        string `json:"flag" mapstructure:"flag"`
+}
+
+func (g *GroupRequest) EventType() EventType {
+	if g.SubType == "invite" {
+		return RequestGroupInvite
+	}
+	return RequestGroupAdd
+}
+
 type SegmentType string
 
 const (
@@ -428,6 +931,7 @@ const (
 
 type ISegment interface {
 	SegmentType() SegmentType
+	segment() *Segment
 }
 
 type Segment struct {
@@ -439,6 +943,10 @@ func (s *Segment) SegmentType() SegmentType {
 	return SegmentType(s.Type)
 }
 
+func (s *Segment) segment() *Segment {
+	return s
+}
+
 type TextSegment struct {
 	Segment `mapstructure:",squash"`
 }
@@ -560,6 +1068,13 @@ func (s *FileSegment) File() string {
 	return s.Data["file"].(string)
 }
 
+func (s *FileSegment) URL() string {
+	if url, ok := s.Data["url"].(string); ok {
+		return url
+	}
+	return ""
+}
+
 func (s *AtSegment) Target() string {
 	return s.Data["qq"].(string)
 }
@@ -601,7 +1116,30 @@ func (s *ReplySegment) ID() string {
 }
 
 func (s *ForwardSegment) ID() string {
-	return s.Data["id"].(string)
+	if id, ok := s.Data["id"].(string); ok {
+		return id
+	}
+	return ""
+}
+
+// Messages returns the nodes embedded in the segment, some agents (e.g. NapCat)
+// deliver nested forwards inline instead of by ID
+func (s *ForwardSegment) Messages() []*Message {
+	content, ok := s.Data["content"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	messages := make([]*Message, 0, len(content))
+	for _, c := range content {
+		if m, ok := c.(map[string]interface{}); ok {
+			if msg, err := unmarshalMessage(m); err == nil {
+				messages = append(messages, msg.(*Message))
+			}
+		}
+	}
+
+	return messages
 }
 
 func (s *NodeSegment) ID() string {
@@ -722,6 +1260,19 @@ func NewLocation(lat, lon float64, title, content string) *LocationSegment {
 	}
 }
 
+func NewNode(name, uin string, content []ISegment) *NodeSegment {
+	return &NodeSegment{
+		Segment{
+			Type: string(Node),
+			Data: map[string]interface{}{
+				"name":    name,
+				"uin":     uin,
+				"content": content,
+			},
+		},
+	}
+}
+
 func NewJSON(content string) *NodeSegment {
 	return &NodeSegment{
 		Segment{
@@ -745,7 +1296,7 @@ func UnmarshalPayload(m map[string]interface{}) (Payload, error) {
 		case "notice":
 			return unmarshalNotice(m)
 		case "request":
-			return unmarshalEvent(m)
+			return unmarshalRequestEvent(m)
 		}
 		return nil, fmt.Errorf("unsupported event %s", postType)
 	} else if _, ok := m["retcode"]; ok {
@@ -782,6 +1333,55 @@ func unmarshalNotice(m map[string]interface{}) (Payload, error) {
 		var event FriendRecall
 		err := mapstructure.WeakDecode(m, &event)
 		return &event, err
+	case "group_increase":
+		var event GroupIncrease
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	case "group_decrease":
+		var event GroupDecrease
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	case "group_admin":
+		var event GroupAdmin
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	case "group_ban":
+		var event GroupBan
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	case "group_msg_emoji_like":
+		var event GroupMsgEmojiLike
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	case "group_upload":
+		var event GroupUpload
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	case "offline_file":
+		var event OfflineFile
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	case "notify":
+		if m["sub_type"] == "poke" {
+			var event Poke
+			err := mapstructure.WeakDecode(m, &event)
+			return &event, err
+		}
+	}
+
+	return unmarshalEvent(m)
+}
+
+func unmarshalRequestEvent(m map[string]interface{}) (Payload, error) {
+	switch m["request_type"] {
+	case "friend":
+		var event FriendRequest
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
+	case "group":
+		var event GroupRequest
+		err := mapstructure.WeakDecode(m, &event)
+		return &event, err
 	}
 
 	return unmarshalEvent(m)
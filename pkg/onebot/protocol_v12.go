@@ -0,0 +1,405 @@
+package onebot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// OneBot12
+	SendMessage   RequestType = "send_message"
+	DeleteMessage RequestType = "delete_message"
+	GetSelfInfo   RequestType = "get_self_info"
+	GetUserInfo   RequestType = "get_user_info"
+	LeaveGroup    RequestType = "leave_group"
+	UploadFile    RequestType = "upload_file"
+	GetVersion    RequestType = "get_version"
+)
+
+// protocolV12 speaks OneBot 12 to agents such as Walle-Q and ComWeChatBot
+type protocolV12 struct {
+	// OneBot 12 reports the status separately from heartbeats, only the receive loop touches these
+	status   Status
+	interval int64
+}
+
+func (p *protocolV12) version() ProtocolVersion {
+	return ProtocolV12
+}
+
+func (p *protocolV12) encodeRequest(c *Client, req *Request) (*Request, error) {
+	params := req.Params
+
+	switch RequestType(req.Action) {
+	case SendMsg, SendPrivateMsg, SendGroupMsg:
+		segments, _ := params["message"].([]ISegment)
+		message, err := encodeSegmentsV12(c, segments)
+		if err != nil {
+			return nil, err
+		}
+		return newSendMessageV12(req, message), nil
+	case UploadGroupFile, UploadPrivateFile:
+		// There is no file message API, upload the file and send it as a segment
+		fileID, err := c.uploadFileV12(fmt.Sprint(params["file"]), fmt.Sprint(params["name"]))
+		if err != nil {
+			return nil, err
+		}
+		message := []map[string]interface{}{{"type": "file", "data": map[string]interface{}{"file_id": fileID}}}
+		return newSendMessageV12(req, message), nil
+	case DeleteMsg:
+		return &Request{Action: string(DeleteMessage), Params: params}, nil
+	case GetLoginInfo:
+		return &Request{Action: string(GetSelfInfo)}, nil
+	case GetStrangerInfo:
+		return &Request{Action: string(GetUserInfo), Params: params}, nil
+	case SetGroupLeave:
+		return &Request{Action: string(LeaveGroup), Params: params}, nil
+	case GetVersionInfo:
+		return &Request{Action: string(GetVersion)}, nil
+	case GetImage, GetRecord, GetFile:
+		return &Request{
+			Action: string(GetFile),
+			Params: map[string]interface{}{
+				"file_id": params["file"],
+				"type":    "data",
+			},
+		}, nil
+	}
+
+	return req, nil
+}
+
+func newSendMessageV12(req *Request, message []map[string]interface{}) *Request {
+	params := map[string]interface{}{"message": message}
+	if groupID, ok := req.Params["group_id"]; ok {
+		params["detail_type"] = "group"
+		params["group_id"] = groupID
+	} else {
+		params["detail_type"] = "private"
+		params["user_id"] = req.Params["user_id"]
+	}
+
+	return &Request{Action: string(SendMessage), Params: params}
+}
+
+func encodeSegmentsV12(c *Client, segments []ISegment) ([]map[string]interface{}, error) {
+	message := make([]map[string]interface{}, 0, len(segments))
+	for _, seg := range segments {
+		data := seg.segment().Data
+		segType := string(seg.SegmentType())
+		v12Data := data
+
+		switch seg.SegmentType() {
+		case At:
+			if data["qq"] == "all" {
+				segType, v12Data = "mention_all", map[string]interface{}{}
+			} else {
+				segType, v12Data = "mention", map[string]interface{}{"user_id": data["qq"]}
+			}
+		case Image, Record, Video, File:
+			fileID, err := c.uploadFileV12(fmt.Sprint(data["file"]), fmt.Sprint(data["name"]))
+			if err != nil {
+				return nil, err
+			}
+			if seg.SegmentType() == Record {
+				segType = "voice"
+			}
+			v12Data = map[string]interface{}{"file_id": fileID}
+		case Reply:
+			v12Data = map[string]interface{}{"message_id": data["id"]}
+		case Location:
+			v12Data = map[string]interface{}{
+				"latitude":  data["lat"],
+				"longitude": data["lon"],
+				"title":     data["title"],
+				"content":   data["content"],
+			}
+		}
+
+		message = append(message, map[string]interface{}{"type": segType, "data": v12Data})
+	}
+
+	return message, nil
+}
+
+// uploadFileV12 turns a OneBot 11 file URI into a OneBot 12 file ID
+func (c *Client) uploadFileV12(file, name string) (string, error) {
+	params := map[string]interface{}{"name": name}
+	if data, ok := strings.CutPrefix(file, "base64://"); ok {
+		params["type"] = "data"
+		params["data"] = data
+	} else if path, ok := strings.CutPrefix(file, "file://"); ok {
+		params["type"] = "path"
+		params["path"] = path
+	} else {
+		params["type"] = "url"
+		params["url"] = file
+	}
+
+	resp, err := c.request(&Request{Action: string(UploadFile), Params: params})
+	if err != nil {
+		return "", err
+	}
+
+	var uploaded struct {
+		FileID string `mapstructure:"file_id"`
+	}
+	if err := mapstructure.WeakDecode(resp, &uploaded); err != nil {
+		return "", err
+	}
+
+	return uploaded.FileID, nil
+}
+
+func (p *protocolV12) decodeResponse(action string, data any) any {
+	switch RequestType(action) {
+	case GetLoginInfo, GetStrangerInfo, GetFriendList:
+		return renameKeys(data, map[string]string{"user_name": "nickname", "user_remark": "remark"})
+	case GetGroupMemberInfo, GetGroupMemberList:
+		return renameKeys(data, map[string]string{"user_name": "nickname", "user_displayname": "card"})
+	case GetImage, GetRecord, GetFile:
+		return renameKeys(data, map[string]string{"name": "file_name", "data": "base64"})
+	case GetVersionInfo:
+		return renameKeys(data, map[string]string{"impl": "app_name", "version": "app_version", "onebot_version": "protocol_version"})
+	case GetStatus:
+		return decodeStatusV12(data)
+	}
+
+	return data
+}
+
+// renameKeys renames the fields of an object, or of each object in a list
+func renameKeys(data any, names map[string]string) any {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if name, ok := names[key]; ok {
+				key = name
+			}
+			renamed[key] = value
+		}
+		return renamed
+	case []interface{}:
+		renamed := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			renamed = append(renamed, renameKeys(item, names))
+		}
+		return renamed
+	}
+
+	return data
+}
+
+// decodeStatusV12 folds the per-bot status of OneBot 12 into the OneBot 11 shape
+func decodeStatusV12(data any) any {
+	status, ok := statusV12(data)
+	if !ok {
+		return data
+	}
+
+	return statusToMap(status)
+}
+
+func statusV12(data any) (Status, bool) {
+	var status struct {
+		Good bool `mapstructure:"good"`
+		Bots []struct {
+			Online bool `mapstructure:"online"`
+		} `mapstructure:"bots"`
+	}
+	if err := mapstructure.WeakDecode(data, &status); err != nil {
+		return Status{}, false
+	}
+
+	online := false
+	for _, bot := range status.Bots {
+		online = online || bot.Online
+	}
+
+	return Status{Online: online, Good: status.Good}, true
+}
+
+func statusToMap(status Status) map[string]interface{} {
+	return map[string]interface{}{"online": status.Online, "good": status.Good}
+}
+
+func (p *protocolV12) decodePayload(m map[string]interface{}) (Payload, error) {
+	if _, ok := m["type"]; !ok {
+		// Responses have the same shape in both versions
+		return UnmarshalPayload(m)
+	}
+
+	selfID, platform := "", ""
+	if self, ok := m["self"].(map[string]interface{}); ok {
+		selfID = fmt.Sprint(self["user_id"])
+		platform, _ = self["platform"].(string)
+	}
+
+	event := map[string]interface{}{
+		"time":     m["time"],
+		"self_id":  selfID,
+		"platform": platform,
+	}
+
+	switch m["type"] {
+	case "meta":
+		if !p.decodeMetaV12(m, event) {
+			return unmarshalEvent(event)
+		}
+	case "message":
+		decodeMessageV12(m, event, selfID)
+	case "notice":
+		if !decodeNoticeV12(m, event, selfID) {
+			return unmarshalEvent(event)
+		}
+	default:
+		return unmarshalEvent(event)
+	}
+
+	return UnmarshalPayload(event)
+}
+
+func (p *protocolV12) decodeMetaV12(m, event map[string]interface{}) bool {
+	event["post_type"] = "meta_event"
+
+	switch m["detail_type"] {
+	case "connect":
+		event["meta_event_type"] = "lifecycle"
+		event["sub_type"] = "connect"
+	case "heartbeat":
+		var heartbeat struct {
+			Interval int64 `mapstructure:"interval"`
+		}
+		mapstructure.WeakDecode(m, &heartbeat)
+		p.interval = heartbeat.Interval
+
+		event["meta_event_type"] = "heartbeat"
+		event["interval"] = p.interval
+		event["status"] = statusToMap(p.status)
+	case "status_update":
+		if status, ok := statusV12(m["status"]); ok {
+			p.status = status
+		}
+		// Without an interval the status is applied with the next heartbeat
+		if p.interval == 0 {
+			return false
+		}
+		event["meta_event_type"] = "heartbeat"
+		event["interval"] = p.interval
+		event["status"] = statusToMap(p.status)
+	default:
+		return false
+	}
+
+	return true
+}
+
+func decodeMessageV12(m, event map[string]interface{}, selfID string) {
+	userID := fmt.Sprint(m["user_id"])
+
+	event["post_type"] = "message"
+	if userID == selfID {
+		event["post_type"] = "message_sent"
+	}
+	event["message_type"] = m["detail_type"]
+	event["sub_type"] = m["sub_type"]
+	event["message_id"] = m["message_id"]
+	event["user_id"] = userID
+	event["sender"] = map[string]interface{}{"user_id": userID}
+	if groupID, ok := m["group_id"]; ok {
+		event["group_id"] = groupID
+	}
+	// Messages sent by self in private chats carry the other user as the target
+	if targetID, ok := m["target_id"]; ok && userID == selfID && m["detail_type"] == "private" {
+		event["target_id"] = fmt.Sprint(targetID)
+	}
+
+	segments, _ := m["message"].([]interface{})
+	event["message"] = decodeSegmentsV12(segments)
+}
+
+func decodeSegmentsV12(segments []interface{}) []interface{} {
+	decoded := make([]interface{}, 0, len(segments))
+	for _, s := range segments {
+		seg, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		data, _ := seg["data"].(map[string]interface{})
+		segType, _ := seg["type"].(string)
+
+		switch segType {
+		case "mention":
+			segType, data = string(At), map[string]interface{}{"qq": data["user_id"]}
+		case "mention_all":
+			segType, data = string(At), map[string]interface{}{"qq": "all"}
+		case "image", "voice", "audio", "video", "file":
+			// The file ID is fetched with get_file when downloading
+			media := map[string]interface{}{"file": data["file_id"], "url": ""}
+			if url, ok := data["url"].(string); ok {
+				media["url"] = url
+			}
+			if name, ok := data["name"]; ok {
+				media["name"] = name
+			}
+			switch segType {
+			case "voice", "audio":
+				segType = string(Record)
+			}
+			data = media
+		case "reply":
+			data = map[string]interface{}{"id": data["message_id"]}
+		case "location":
+			data = map[string]interface{}{
+				"lat":     data["latitude"],
+				"lon":     data["longitude"],
+				"title":   data["title"],
+				"content": data["content"],
+			}
+		}
+
+		decoded = append(decoded, map[string]interface{}{"type": segType, "data": data})
+	}
+
+	return decoded
+}
+
+func decodeNoticeV12(m, event map[string]interface{}, selfID string) bool {
+	event["post_type"] = "notice"
+	for _, key := range []string{"group_id", "user_id", "operator_id", "message_id"} {
+		if value, ok := m[key]; ok {
+			event[key] = value
+		}
+	}
+
+	switch m["detail_type"] {
+	case "friend_increase":
+		event["notice_type"] = "friend_add"
+	case "group_member_increase":
+		event["notice_type"] = "group_increase"
+		event["sub_type"] = "approve"
+		if m["sub_type"] == "invite" {
+			event["sub_type"] = "invite"
+		}
+	case "group_member_decrease":
+		event["notice_type"] = "group_decrease"
+		event["sub_type"] = "leave"
+		if m["sub_type"] == "kick" {
+			event["sub_type"] = "kick"
+			if fmt.Sprint(m["user_id"]) == selfID {
+				event["sub_type"] = "kick_me"
+			}
+		}
+	case "group_message_delete":
+		event["notice_type"] = "group_recall"
+	case "private_message_delete":
+		event["notice_type"] = "friend_recall"
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,105 @@
+package onebot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeMessageV12(t *testing.T) {
+	p := newProtocol(ProtocolV12)
+
+	payload, err := p.decodePayload(map[string]interface{}{
+		"id":          "event-1",
+		"time":        1700000000,
+		"type":        "message",
+		"detail_type": "group",
+		"sub_type":    "",
+		"message_id":  "42",
+		"group_id":    "1000",
+		"user_id":     "2000",
+		"self":        map[string]interface{}{"platform": "qq", "user_id": "3000"},
+		"message": []interface{}{
+			map[string]interface{}{"type": "text", "data": map[string]interface{}{"text": "hi "}},
+			map[string]interface{}{"type": "mention", "data": map[string]interface{}{"user_id": "3000"}},
+			map[string]interface{}{"type": "voice", "data": map[string]interface{}{"file_id": "f1"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("decodePayload failed: %v", err)
+	}
+
+	msg, ok := payload.(*Message)
+	if !ok {
+		t.Fatalf("decodePayload returned %T, want *Message", payload)
+	}
+	if msg.EventType() != MessageGroup || msg.GroupID != "1000" || msg.UserID != "2000" || msg.MessageID != "42" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if msg.SelfID != "3000" || msg.Platform != "qq" {
+		t.Errorf("self = %q on %q, want 3000 on qq", msg.SelfID, msg.Platform)
+	}
+
+	segments, _ := msg.Message.([]ISegment)
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(segments))
+	}
+	if at, ok := segments[1].(*AtSegment); !ok || at.Target() != "3000" {
+		t.Errorf("segment 1 = %+v, want mention of 3000", segments[1])
+	}
+	if record, ok := segments[2].(*RecordSegment); !ok || record.File() != "f1" {
+		t.Errorf("segment 2 = %+v, want record f1", segments[2])
+	}
+}
+
+func TestDecodeMessageV12SelfPrivate(t *testing.T) {
+	event := map[string]interface{}{}
+	decodeMessageV12(map[string]interface{}{
+		"detail_type": "private",
+		"message_id":  "42",
+		"user_id":     "3000",
+		"target_id":   2000,
+	}, event, "3000")
+
+	if event["post_type"] != "message_sent" {
+		t.Errorf("post_type = %v, want message_sent", event["post_type"])
+	}
+	if event["target_id"] != "2000" {
+		t.Errorf("target_id = %v, want 2000", event["target_id"])
+	}
+}
+
+func TestDecodeResponseV12(t *testing.T) {
+	p := newProtocol(ProtocolV12)
+
+	tests := []struct {
+		action string
+		data   any
+		want   any
+	}{
+		{
+			string(GetLoginInfo),
+			map[string]interface{}{"user_id": "1", "user_name": "bot"},
+			map[string]interface{}{"user_id": "1", "nickname": "bot"},
+		},
+		{
+			string(GetGroupMemberList),
+			[]interface{}{map[string]interface{}{"user_id": "1", "user_displayname": "card"}},
+			[]interface{}{map[string]interface{}{"user_id": "1", "card": "card"}},
+		},
+		{
+			string(GetVersionInfo),
+			map[string]interface{}{"impl": "walle-q", "version": "0.1", "onebot_version": "12"},
+			map[string]interface{}{"app_name": "walle-q", "app_version": "0.1", "protocol_version": "12"},
+		},
+		{
+			string(SendMsg),
+			map[string]interface{}{"message_id": "1"},
+			map[string]interface{}{"message_id": "1"},
+		},
+	}
+	for _, tt := range tests {
+		if got := p.decodeResponse(tt.action, tt.data); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeResponse(%s) = %v, want %v", tt.action, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,11 @@ package onebot
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
@@ -16,21 +21,29 @@ var upgrader = websocket.Upgrader{}
 type Service struct {
 	log zerolog.Logger
 
-	endpoint string
-	timeout  time.Duration
+	endpoint       string
+	timeout        time.Duration
+	reconnectGrace time.Duration
 
 	server *http.Server
+	media  *mediaStore
 
 	clients     map[string]*Client
 	clientsLock sync.RWMutex
+	// Clients registered over another client with the same token, e.g. to probe it on login
+	shadowed map[*Client]*Client
 }
 
-func NewService(log zerolog.Logger, endpoint string, timeout time.Duration) *Service {
+func NewService(log zerolog.Logger, endpoint string, timeout, reconnectGrace time.Duration, media MediaConfig) *Service {
+	log = log.With().Str("service", "onebot").Logger()
 	service := &Service{
-		log:      log.With().Str("service", "onebot").Logger(),
-		endpoint: endpoint,
-		timeout:  timeout,
-		clients:  make(map[string]*Client),
+		log:            log,
+		endpoint:       endpoint,
+		timeout:        timeout,
+		reconnectGrace: reconnectGrace,
+		media:          newMediaStore(log, media),
+		clients:        make(map[string]*Client),
+		shadowed:       make(map[*Client]*Client),
 	}
 	service.server = &http.Server{
 		Addr:    endpoint,
@@ -70,12 +83,39 @@ func (s *Service) NewClient(log zerolog.Logger, id, token string) *Client {
 	defer s.clientsLock.Unlock()
 
 	client := NewClient(log, id, token, s)
-	s.clients[token] = client
+	s.registerClient(client)
 
 	return client
 }
 
+// addClient registers a client again after it was released and reconnects
+func (s *Service) addClient(client *Client) {
+	s.clientsLock.Lock()
+	defer s.clientsLock.Unlock()
+
+	s.registerClient(client)
+}
+
+func (s *Service) registerClient(client *Client) {
+	if prev, ok := s.clients[client.token]; ok && prev != client {
+		s.shadowed[client] = prev
+	}
+	s.clients[client.token] = client
+}
+
 func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Media URLs carry their own token instead of the access token of the client
+	if strings.HasPrefix(r.URL.Path, mediaPathPrefix) {
+		s.media.serveHTTP(w, r)
+		return
+	}
+
+	// Events posted by agents using the HTTP transport
+	if r.Method == http.MethodPost && r.URL.Path == webhookPath {
+		s.serveWebhook(w, r)
+		return
+	}
+
 	authHeader := r.Header.Get("Authorization")
 	if !strings.HasPrefix(authHeader, "Bearer ") {
 		http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
@@ -91,32 +131,128 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if client.id != "" && client.id != r.Header.Get("X-Self-ID") {
+	version, subprotocol := versionFromHeader(r.Header)
+	client.setProtocolVersion(version)
+
+	// OneBot 12 agents may serve several bots and don't send X-Self-ID
+	if client.id != "" && version == ProtocolV11 && client.id != r.Header.Get("X-Self-ID") {
 		http.Error(w, "The login ID does not match", http.StatusUnauthorized)
 		return
 	}
 
 	agent := r.Header.Get("User-Agent")
 	if strings.HasPrefix(agent, "LLOneBot") {
-		client.agentType = AgentLLOneBot
-	} else if strings.HasPrefix(agent, "WeChat") {
-		client.agentType = AgentWeChat
+		client.setAgentType(AgentLLOneBot)
+	} else if strings.HasPrefix(agent, "WeChat") || strings.Contains(strings.ToLower(r.Header.Get("X-Impl")), "wechat") {
+		client.setAgentType(AgentWeChat)
 	} else {
-		client.agentType = AgentNapCat
+		client.setAgentType(AgentNapCat)
+	}
+
+	var responseHeader http.Header
+	if subprotocol != "" {
+		responseHeader = http.Header{"Sec-WebSocket-Protocol": {subprotocol}}
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		s.log.Warn().Err(err).Msg("Failed to upgrade websocket request")
 		return
 	}
 
-	go client.StartLoop(conn)
+	go client.StartLoop(newWSTransport(conn))
 }
 
-func (s *Service) removeClient(id string) {
+// removeClient unregisters a released client, unless a newer client took over its token.
+// The client it took the token over from gets it back.
+func (s *Service) removeClient(client *Client) {
 	s.clientsLock.Lock()
 	defer s.clientsLock.Unlock()
 
-	delete(s.clients, id)
+	prev, shadowing := s.shadowed[client]
+	delete(s.shadowed, client)
+	for other, shadowed := range s.shadowed {
+		if shadowed == client {
+			if shadowing {
+				s.shadowed[other] = prev
+			} else {
+				delete(s.shadowed, other)
+			}
+		}
+	}
+
+	if s.clients[client.token] != client {
+		return
+	} else if shadowing {
+		s.clients[client.token] = prev
+	} else {
+		delete(s.clients, client.token)
+	}
+}
+
+const webhookPath = "/webhook"
+
+// requestToken returns the access token of a request, as bearer token or as query parameter
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+func (s *Service) serveWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	client := s.authenticateWebhook(r, body)
+	if client == nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !client.handleWebhook(m) {
+		http.Error(w, "Client doesn't use the HTTP transport", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticateWebhook accepts the access token as bearer token, as query parameter,
+// or as the secret of the X-Signature HMAC some agents use for HTTP posts
+func (s *Service) authenticateWebhook(r *http.Request, body []byte) *Client {
+	s.clientsLock.RLock()
+	defer s.clientsLock.RUnlock()
+
+	token := requestToken(r)
+	if client, ok := s.clients[token]; ok && token != "" {
+		return client
+	}
+
+	signature, ok := strings.CutPrefix(r.Header.Get("X-Signature"), "sha1=")
+	if !ok {
+		return nil
+	}
+	selfID := r.Header.Get("X-Self-ID")
+	for token, client := range s.clients {
+		if client.id != selfID {
+			continue
+		}
+		mac := hmac.New(sha1.New, []byte(token))
+		mac.Write(body)
+		if hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(signature)) {
+			return client
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,49 @@
+package onebot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestReleasedClientRestoresShadowedClient(t *testing.T) {
+	s := NewService(zerolog.Nop(), "", time.Second, 0, MediaConfig{})
+
+	login := s.NewClient(zerolog.Nop(), "1", "token")
+	probe := s.NewClient(zerolog.Nop(), "", "token")
+	if s.clients["token"] != probe {
+		t.Fatal("probe client isn't registered")
+	}
+
+	probe.Release()
+	if s.clients["token"] != login {
+		t.Fatal("login client wasn't restored after the probe was released")
+	}
+
+	login.Release()
+	if _, ok := s.clients["token"]; ok {
+		t.Fatal("released login client is still registered")
+	}
+}
+
+func TestReleasedShadowedClientIsNotRestored(t *testing.T) {
+	s := NewService(zerolog.Nop(), "", time.Second, 0, MediaConfig{})
+
+	old := s.NewClient(zerolog.Nop(), "1", "token")
+	replacement := s.NewClient(zerolog.Nop(), "1", "token")
+
+	// The replaced login is deleted before its replacement is released
+	old.Release()
+	if s.clients["token"] != replacement {
+		t.Fatal("releasing the replaced client unregistered its replacement")
+	}
+
+	replacement.Release()
+	if _, ok := s.clients["token"]; ok {
+		t.Fatal("released client was restored")
+	}
+	if len(s.shadowed) != 0 {
+		t.Fatalf("%d shadowed clients left", len(s.shadowed))
+	}
+}
@@ -0,0 +1,293 @@
+package onebot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mitchellh/mapstructure"
+)
+
+type TransportMode string
+
+const (
+	// The agent connects to the service
+	TransportReverseWS TransportMode = "reverse_ws"
+	// The bridge connects to the WebSocket server of the agent
+	TransportForwardWS TransportMode = "forward_ws"
+	// The bridge calls the HTTP API of the agent, events are posted to the service
+	TransportHTTP TransportMode = "http"
+)
+
+const (
+	minBackoff = 1 * time.Second
+	maxBackoff = 1 * time.Minute
+
+	httpStatusInterval = 30 * time.Second
+)
+
+var errTransportClosed = errors.New("transport closed")
+
+// Transport carries requests to the agent and payloads (responses and events) back
+type Transport interface {
+	// WriteRequest sends a request, its response is returned by ReadPayload later
+	WriteRequest(req *Request) error
+	// ReadPayload blocks until the next payload from the agent
+	ReadPayload() (map[string]interface{}, error)
+	Close() error
+}
+
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func newWSTransport(conn *websocket.Conn) *wsTransport {
+	return &wsTransport{conn: conn}
+}
+
+func (t *wsTransport) WriteRequest(req *Request) error {
+	return t.conn.WriteJSON(req)
+}
+
+func (t *wsTransport) ReadPayload() (map[string]interface{}, error) {
+	for {
+		mt, message, err := t.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		if mt != websocket.TextMessage {
+			continue
+		}
+
+		var m map[string]interface{}
+		if err := json.Unmarshal(message, &m); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+		}
+
+		return m, nil
+	}
+}
+
+func (t *wsTransport) Close() error {
+	return t.conn.Close()
+}
+
+type httpTransport struct {
+	endpoint string
+	token    string
+	client   *http.Client
+	// OneBot 12 posts every action to the endpoint itself
+	version func() ProtocolVersion
+
+	payloads  chan map[string]interface{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newHTTPTransport(endpoint, token string, timeout time.Duration, version func() ProtocolVersion) *httpTransport {
+	return &httpTransport{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		token:    token,
+		client:   &http.Client{Timeout: timeout},
+		version:  version,
+		payloads: make(chan map[string]interface{}, 64),
+		done:     make(chan struct{}),
+	}
+}
+
+// WriteRequest calls the API in the background, so slow actions don't hold up other requests
+func (t *httpTransport) WriteRequest(req *Request) error {
+	select {
+	case <-t.done:
+		return errTransportClosed
+	default:
+	}
+
+	go func() {
+		resp, err := t.call(req)
+		if err != nil {
+			resp = map[string]interface{}{"status": "failed", "retcode": -1, "message": err.Error()}
+		}
+		resp["echo"] = req.Echo
+		t.deliver(resp)
+	}()
+
+	return nil
+}
+
+func (t *httpTransport) call(req *Request) (map[string]interface{}, error) {
+	url := t.endpoint + "/" + req.Action
+	var body []byte
+	var err error
+	if t.version() == ProtocolV12 {
+		url = t.endpoint
+		body, err = json.Marshal(req)
+	} else {
+		body, err = json.Marshal(req.Params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if t.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", httpResp.StatusCode)
+	}
+
+	var m map[string]interface{}
+	if err := json.NewDecoder(httpResp.Body).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// deliver passes a payload (a response or an event from the webhook) to the receive loop
+func (t *httpTransport) deliver(m map[string]interface{}) {
+	select {
+	case t.payloads <- m:
+	case <-t.done:
+	}
+}
+
+func (t *httpTransport) ReadPayload() (map[string]interface{}, error) {
+	select {
+	case m := <-t.payloads:
+		return m, nil
+	case <-t.done:
+		return nil, errTransportClosed
+	}
+}
+
+func (t *httpTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+	return nil
+}
+
+// Start connects to the agent with the given transport, reverse WebSocket clients wait for the agent instead
+func (c *Client) Start(mode TransportMode, endpoint string) {
+	c.service.addClient(c)
+	if mode == TransportReverseWS || mode == "" {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.connLock.Lock()
+	c.cancelDial = cancel
+	c.connLock.Unlock()
+
+	switch mode {
+	case TransportForwardWS:
+		go c.dialLoop(ctx, endpoint)
+	case TransportHTTP:
+		// The protocol version is detected from the events the agent posts
+		t := newHTTPTransport(endpoint, c.token, c.service.timeout, c.GetProtocolVersion)
+		go func() {
+			<-ctx.Done()
+			t.Close()
+		}()
+		go c.StartLoop(t)
+		go c.pollStatus(ctx)
+	default:
+		c.log.Error().Str("mode", string(mode)).Msg("Unknown transport mode")
+	}
+}
+
+// dialLoop keeps a forward WebSocket connection to the agent open, backing off between failures
+func (c *Client) dialLoop(ctx context.Context, endpoint string) {
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	// OneBot 12 agents pick the subprotocol, so requests are in the right format before their first event
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{forwardSubprotocolV12}
+
+	backoff := minBackoff
+	for {
+		conn, resp, err := dialer.DialContext(ctx, endpoint, header)
+		if err != nil {
+			c.log.Warn().Err(err).Str("endpoint", endpoint).Dur("backoff", backoff).Msg("Failed to connect to agent")
+		} else {
+			c.log.Info().Str("endpoint", endpoint).Msg("Connected to agent")
+			backoff = minBackoff
+			if version, _ := versionFromHeader(resp.Header); version == ProtocolV12 {
+				c.setProtocolVersion(ProtocolV12)
+			}
+			c.StartLoop(newWSTransport(conn))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// pollStatus stands in for heartbeats over HTTP, which only arrive if the agent posts them
+func (c *Client) pollStatus(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		interval := httpStatusInterval
+		resp, err := c.request(&Request{Action: string(GetStatus)})
+		if err != nil {
+			c.log.Warn().Err(err).Dur("backoff", backoff).Msg("Failed to get agent status")
+			c.isLoggedIn.Store(false)
+			c.setStatus(StatusDisconnected)
+			interval = backoff
+			backoff = min(backoff*2, maxBackoff)
+		} else {
+			var status Status
+			if err := mapstructure.WeakDecode(resp, &status); err == nil {
+				c.applyStatus(status)
+			}
+			backoff = minBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// handleWebhook receives an event posted by the agent in HTTP mode
+func (c *Client) handleWebhook(m map[string]interface{}) bool {
+	c.connLock.Lock()
+	t, ok := c.transport.(*httpTransport)
+	c.connLock.Unlock()
+	if !ok {
+		return false
+	}
+
+	t.deliver(m)
+	return true
+}
@@ -0,0 +1,109 @@
+package onebot
+
+import (
+	"net/http"
+	"strings"
+)
+
+type ProtocolVersion int
+
+// Offered when dialing the agent, OneBot 11 agents ignore it
+const forwardSubprotocolV12 = "12.pylon"
+
+const (
+	ProtocolV11 ProtocolVersion = 11
+	ProtocolV12 ProtocolVersion = 12
+)
+
+// protocol translates between the OneBot 11 model the bridge works with and the wire format of the agent
+type protocol interface {
+	version() ProtocolVersion
+	// encodeRequest rewrites a request before it is sent, media may be uploaded through the client first
+	encodeRequest(c *Client, req *Request) (*Request, error)
+	// decodeResponse rewrites the data of a response to a request with the given (OneBot 11) action
+	decodeResponse(action string, data any) any
+	decodePayload(m map[string]interface{}) (Payload, error)
+}
+
+type protocolV11 struct{}
+
+func (protocolV11) version() ProtocolVersion {
+	return ProtocolV11
+}
+
+func (protocolV11) encodeRequest(c *Client, req *Request) (*Request, error) {
+	return req, nil
+}
+
+func (protocolV11) decodeResponse(action string, data any) any {
+	return data
+}
+
+func (protocolV11) decodePayload(m map[string]interface{}) (Payload, error) {
+	return UnmarshalPayload(m)
+}
+
+func newProtocol(version ProtocolVersion) protocol {
+	if version == ProtocolV12 {
+		return &protocolV12{status: Status{Online: true, Good: true}}
+	}
+	return protocolV11{}
+}
+
+// versionFromHeader negotiates the protocol of a reverse WebSocket connection,
+// OneBot 12 agents announce themselves with a "12.<impl>" subprotocol
+func versionFromHeader(header http.Header) (ProtocolVersion, string) {
+	for _, subprotocol := range websocketSubprotocols(header) {
+		if strings.HasPrefix(subprotocol, "12.") {
+			return ProtocolV12, subprotocol
+		}
+	}
+	if header.Get("X-OneBot-Version") == "12" {
+		return ProtocolV12, ""
+	}
+
+	return ProtocolV11, ""
+}
+
+func websocketSubprotocols(header http.Header) []string {
+	var subprotocols []string
+	for _, value := range header.Values("Sec-WebSocket-Protocol") {
+		for _, subprotocol := range strings.Split(value, ",") {
+			subprotocols = append(subprotocols, strings.TrimSpace(subprotocol))
+		}
+	}
+	return subprotocols
+}
+
+// isV12Payload reports whether a payload is a OneBot 12 event, used to detect the protocol
+// of connections the bridge opens itself
+func isV12Payload(m map[string]interface{}) bool {
+	_, hasPostType := m["post_type"]
+	_, hasDetailType := m["detail_type"]
+	return !hasPostType && hasDetailType
+}
+
+func (c *Client) GetProtocolVersion() ProtocolVersion {
+	return c.getProtocol().version()
+}
+
+func (c *Client) getProtocol() protocol {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	return c.protocol
+}
+
+// setProtocolVersion switches the protocol of the client, it reports whether the version changed
+func (c *Client) setProtocolVersion(version ProtocolVersion) bool {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	if c.protocol != nil && c.protocol.version() == version {
+		return false
+	}
+
+	c.log.Info().Int("version", int(version)).Msg("Using OneBot protocol version")
+	c.protocol = newProtocol(version)
+	return true
+}
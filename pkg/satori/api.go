@@ -0,0 +1,469 @@
+package satori
+
+import (
+	"cmp"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/duo/matrix-pylon/pkg/onebot"
+	"github.com/duo/matrix-pylon/pkg/util"
+)
+
+func (c *Client) GetLoginInfo() (*onebot.UserInfo, error) {
+	var login Login
+	if err := c.call("login.get", struct{}{}, &login); err != nil {
+		return nil, err
+	}
+
+	info := &onebot.UserInfo{ID: login.ID()}
+	if login.User != nil {
+		info.Nickname = cmp.Or(login.User.Name, login.User.Nick)
+		info.Avatar = login.User.Avatar
+	}
+
+	return info, nil
+}
+
+func (c *Client) GetUserInfo(userID string) (*onebot.UserInfo, error) {
+	var user User
+	if err := c.call("user.get", map[string]interface{}{"user_id": userID}, &user); err != nil {
+		return nil, err
+	}
+
+	return userToOnebot(&user), nil
+}
+
+func (c *Client) GetGroupInfo(groupID string) (*onebot.GroupInfo, error) {
+	var guild Guild
+	if err := c.call("guild.get", map[string]interface{}{"guild_id": groupID}, &guild); err != nil {
+		return nil, err
+	}
+
+	return guildToOnebot(&guild), nil
+}
+
+func (c *Client) GetFriendList() ([]*onebot.UserInfo, error) {
+	users, err := listAll[User](c, "friend.list", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	friends := make([]*onebot.UserInfo, 0, len(users))
+	for _, user := range users {
+		friends = append(friends, userToOnebot(user))
+	}
+
+	return friends, nil
+}
+
+func (c *Client) GetGroupList() ([]*onebot.GroupInfo, error) {
+	guilds, err := listAll[Guild](c, "guild.list", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*onebot.GroupInfo, 0, len(guilds))
+	for _, guild := range guilds {
+		groups = append(groups, guildToOnebot(guild))
+	}
+
+	return groups, nil
+}
+
+func (c *Client) GetGroupMemberList(groupID string) ([]*onebot.MemberInfo, error) {
+	members, err := listAll[GuildMember](c, "guild.member.list", map[string]interface{}{"guild_id": groupID})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*onebot.MemberInfo, 0, len(members))
+	for _, member := range members {
+		if info := memberToOnebot(groupID, member); info != nil {
+			result = append(result, info)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *Client) GetGroupMemberInfo(groupID string, userID string) (*onebot.MemberInfo, error) {
+	var member GuildMember
+	params := map[string]interface{}{"guild_id": groupID, "user_id": userID}
+	if err := c.call("guild.member.get", params, &member); err != nil {
+		return nil, err
+	}
+
+	info := memberToOnebot(groupID, &member)
+	if info == nil {
+		info = &onebot.MemberInfo{UserID: userID, GroupID: groupID, Nickname: member.Nick}
+	}
+
+	return info, nil
+}
+
+// listAll follows the next tokens of a paginated list
+func listAll[T any](c *Client, method string, params map[string]interface{}) ([]*T, error) {
+	var result []*T
+	for {
+		var list List[*T]
+		if err := c.call(method, params, &list); err != nil {
+			return nil, err
+		}
+		result = append(result, list.Data...)
+
+		if list.Next == "" {
+			return result, nil
+		}
+		params["next"] = list.Next
+	}
+}
+
+func userToOnebot(user *User) *onebot.UserInfo {
+	return &onebot.UserInfo{
+		ID:       user.ID,
+		Nickname: cmp.Or(user.Name, user.Nick),
+		Avatar:   user.Avatar,
+	}
+}
+
+func guildToOnebot(guild *Guild) *onebot.GroupInfo {
+	return &onebot.GroupInfo{
+		ID:     guild.ID,
+		Name:   guild.Name,
+		Avatar: guild.Avatar,
+	}
+}
+
+func memberToOnebot(groupID string, member *GuildMember) *onebot.MemberInfo {
+	if member.User == nil {
+		return nil
+	}
+
+	return &onebot.MemberInfo{
+		UserID:   member.User.ID,
+		GroupID:  groupID,
+		Nickname: cmp.Or(member.User.Name, member.User.Nick),
+		Card:     member.Nick,
+		Avatar:   cmp.Or(member.Avatar, member.User.Avatar),
+		Role:     "member",
+	}
+}
+
+// directChannel returns the channel for direct messages with a user
+func (c *Client) directChannel(userID string) (string, error) {
+	if channelID, ok := c.userChannels.Get(userID); ok {
+		return channelID, nil
+	}
+
+	var channel Channel
+	if err := c.call("user.channel.create", map[string]interface{}{"user_id": userID}, &channel); err != nil {
+		return "", err
+	}
+	c.rememberDirectChannel(userID, channel.ID)
+
+	return channel.ID, nil
+}
+
+// groupChannel looks up the text channel of a guild, preferring the one sharing its ID
+func (c *Client) groupChannel(groupID string) (string, error) {
+	channels, err := listAll[Channel](c, "channel.list", map[string]interface{}{"guild_id": groupID})
+	if err != nil {
+		return "", err
+	}
+
+	channelID := ""
+	for _, channel := range channels {
+		if channel.ID == groupID {
+			return channel.ID, nil
+		} else if channel.Type == ChannelText && channelID == "" {
+			channelID = channel.ID
+		}
+	}
+	if channelID == "" {
+		return "", fmt.Errorf("群 %s 没有文字频道", groupID)
+	}
+
+	return channelID, nil
+}
+
+func (c *Client) messageChannel(messageID string) (string, error) {
+	if channelID, ok := c.messageChannels.Get(messageID); ok {
+		return channelID, nil
+	}
+
+	return "", fmt.Errorf("未知的消息 %s", messageID)
+}
+
+func (c *Client) sendContent(channelID, content string) (*onebot.SendMessageResponse, error) {
+	var messages []*Message
+	params := map[string]interface{}{"channel_id": channelID, "content": content}
+	if err := c.call("message.create", params, &messages); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("Satori没有返回消息")
+	}
+
+	for _, msg := range messages {
+		c.messageChannels.Add(msg.ID, channelID)
+	}
+
+	return &onebot.SendMessageResponse{MessageID: messages[0].ID}, nil
+}
+
+func (c *Client) SendPrivateMessage(userID string, segments []onebot.ISegment) (*onebot.SendMessageResponse, error) {
+	channelID, err := c.directChannel(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.sendContent(channelID, encodeContent(segments))
+}
+
+func (c *Client) SendGroupMessage(groupID string, segments []onebot.ISegment) (*onebot.SendMessageResponse, error) {
+	return c.sendContent(groupID, encodeContent(segments))
+}
+
+func (c *Client) SendPrivateForwardMessage(userID string, nodes []onebot.ISegment) (*onebot.SendMessageResponse, error) {
+	return nil, errNotSupported
+}
+
+func (c *Client) SendGroupForwardMessage(groupID string, nodes []onebot.ISegment) (*onebot.SendMessageResponse, error) {
+	return nil, errNotSupported
+}
+
+func (c *Client) SendForwardMessage(messageType, targetID string, nodes []onebot.ISegment) (*onebot.SendMessageResponse, error) {
+	return nil, errNotSupported
+}
+
+func (c *Client) GetMessage(messageID string) (*onebot.Message, error) {
+	channelID, err := c.messageChannel(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg Message
+	params := map[string]interface{}{"channel_id": channelID, "message_id": messageID}
+	if err := c.call("message.get", params, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Channel == nil {
+		msg.Channel = &Channel{ID: channelID}
+	}
+
+	return c.decodeMessage(&msg)
+}
+
+func (c *Client) decodeMessage(msg *Message) (*onebot.Message, error) {
+	_, selfID := c.getSelf()
+	m := c.messageToOnebot(msg, nil, selfID)
+	if m == nil {
+		return nil, fmt.Errorf("无效的消息数据: %+v", msg)
+	}
+
+	payload, err := onebot.UnmarshalPayload(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload.(*onebot.Message), nil
+}
+
+func (c *Client) GetGroupMsgHistory(groupID, messageSeq string, count int) ([]*onebot.Message, error) {
+	return c.listMessages(&Channel{ID: groupID, Type: ChannelText}, messageSeq, count)
+}
+
+func (c *Client) GetFriendMsgHistory(userID, messageSeq string, count int) ([]*onebot.Message, error) {
+	channelID, err := c.directChannel(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.listMessages(&Channel{ID: channelID, Type: ChannelDirect}, messageSeq, count)
+}
+
+// listMessages returns up to count messages before messageSeq (a message ID here), oldest first
+func (c *Client) listMessages(channel *Channel, messageSeq string, count int) ([]*onebot.Message, error) {
+	params := map[string]interface{}{
+		"channel_id": channel.ID,
+		"direction":  "before",
+		"limit":      count,
+		"order":      "asc",
+	}
+	if messageSeq != "" {
+		params["next"] = messageSeq
+	}
+
+	var list BidiList[*Message]
+	if err := c.call("message.list", params, &list); err != nil {
+		return nil, err
+	}
+
+	messages := make([]*onebot.Message, 0, len(list.Data))
+	for _, msg := range list.Data {
+		if msg.Channel == nil {
+			msg.Channel = channel
+		}
+		if decoded, err := c.decodeMessage(msg); err == nil {
+			messages = append(messages, decoded)
+		}
+	}
+
+	return messages, nil
+}
+
+func (c *Client) GetForwardMessage(messageID string) ([]*onebot.Message, error) {
+	return nil, errNotSupported
+}
+
+func (c *Client) DeleteMessage(messageID string) error {
+	channelID, err := c.messageChannel(messageID)
+	if err != nil {
+		return err
+	}
+
+	return c.call("message.delete", map[string]interface{}{"channel_id": channelID, "message_id": messageID}, nil)
+}
+
+func (c *Client) MarkMsgAsRead(messageID string) error {
+	return errNotSupported
+}
+
+func (c *Client) MarkPrivateMsgAsRead(userID string) error {
+	return errNotSupported
+}
+
+func (c *Client) MarkGroupMsgAsRead(groupID string) error {
+	return errNotSupported
+}
+
+func (c *Client) SetMsgEmojiLike(messageID, emojiID string, set bool) error {
+	channelID, err := c.messageChannel(messageID)
+	if err != nil {
+		return err
+	}
+
+	method := "reaction.create"
+	if !set {
+		method = "reaction.delete"
+	}
+
+	return c.call(method, map[string]interface{}{"channel_id": channelID, "message_id": messageID, "emoji": emojiID}, nil)
+}
+
+func (c *Client) SetFriendAddRequest(flag string, approve bool) error {
+	return c.call("friend.approve", map[string]interface{}{"message_id": flag, "approve": approve}, nil)
+}
+
+func (c *Client) SetGroupAddRequest(flag, subType string, approve bool, reason string) error {
+	method := "guild.member.approve"
+	if subType == "invite" {
+		method = "guild.approve"
+	}
+
+	return c.call(method, map[string]interface{}{"message_id": flag, "approve": approve, "comment": reason}, nil)
+}
+
+func (c *Client) SetGroupKick(groupID, userID string, rejectAddRequest bool) error {
+	params := map[string]interface{}{"guild_id": groupID, "user_id": userID, "permanent": rejectAddRequest}
+	return c.call("guild.member.kick", params, nil)
+}
+
+func (c *Client) SetGroupLeave(groupID string) error {
+	return errNotSupported
+}
+
+// SetGroupName renames the text channel of the group, Satori can't rename guilds
+func (c *Client) SetGroupName(groupID, name string) error {
+	channelID, err := c.groupChannel(groupID)
+	if err != nil {
+		return err
+	}
+
+	params := map[string]interface{}{"channel_id": channelID, "data": map[string]interface{}{"name": name}}
+	return c.call("channel.update", params, nil)
+}
+
+func (c *Client) SetGroupCard(groupID, userID, card string) error {
+	return errNotSupported
+}
+
+func (c *Client) SetGroupPortrait(groupID, file string) error {
+	return errNotSupported
+}
+
+func (c *Client) SetGroupAdmin(groupID, userID string, enable bool) error {
+	return errNotSupported
+}
+
+func (c *Client) SetGroupBan(groupID, userID string, duration time.Duration) error {
+	params := map[string]interface{}{"guild_id": groupID, "user_id": userID, "duration": duration.Milliseconds()}
+	return c.call("guild.member.mute", params, nil)
+}
+
+func (c *Client) SetGroupWholeBan(groupID string, enable bool) error {
+	return errNotSupported
+}
+
+func (c *Client) GroupPoke(groupID, userID string) error {
+	return errNotSupported
+}
+
+func (c *Client) FriendPoke(userID string) error {
+	return errNotSupported
+}
+
+func (c *Client) UploadGroupFile(groupID, file, name string) error {
+	_, err := c.SendGroupMessage(groupID, []onebot.ISegment{onebot.NewFile(file, name)})
+	return err
+}
+
+func (c *Client) UploadPrivateFile(userID, file, name string) error {
+	_, err := c.SendPrivateMessage(userID, []onebot.ISegment{onebot.NewFile(file, name)})
+	return err
+}
+
+func (c *Client) DownloadMedia(seg onebot.ISegment) (string, []byte, error) {
+	src, _ := segmentData(seg)["url"].(string)
+	if src == "" {
+		return "", nil, fmt.Errorf("不支持的媒体资源类型 %+v", seg.SegmentType())
+	}
+
+	if data, ok := strings.CutPrefix(src, "data:"); ok {
+		mimeType, encoded, _ := strings.Cut(data, ";base64,")
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		fileName := "file"
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			fileName += exts[0]
+		}
+		return fileName, decoded, err
+	}
+
+	// Resources only the Satori server can reach are fetched through its proxy
+	if strings.HasPrefix(src, "internal:") {
+		c.lock.Lock()
+		src = c.endpoint + "/v1/proxy/" + src
+		c.lock.Unlock()
+	}
+
+	return util.Download(src)
+}
+
+// MediaURI inlines media as a data URL, which Satori accepts wherever a resource URL is expected
+func (c *Client) MediaURI(data []byte, name string) string {
+	mimeType := cmp.Or(mime.TypeByExtension(filepath.Ext(name)), "application/octet-stream")
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func (c *Client) MediaFileURI(path, name string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return c.MediaURI(data, name), nil
+}
@@ -0,0 +1,358 @@
+package satori
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/duo/matrix-pylon/pkg/onebot"
+
+	"github.com/gorilla/websocket"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/rs/zerolog"
+)
+
+const (
+	minBackoff   = 1 * time.Second
+	maxBackoff   = 1 * time.Minute
+	pingInterval = 10 * time.Second
+)
+
+var errNotSupported = errors.New("Satori不支持该操作")
+
+// Client drives a Satori login through the HTTP API and the WebSocket event stream,
+// translating everything to the OneBot model the bridge works with
+type Client struct {
+	log zerolog.Logger
+
+	id         string
+	token      string
+	httpClient *http.Client
+
+	eventHandler  func(onebot.IEvent)
+	statusHandler func(onebot.ClientStatus)
+	lastStatus    atomic.Int32
+	statusLock    sync.Mutex
+	isLoggedIn    atomic.Bool
+
+	// Guarded by lock
+	lock     sync.Mutex
+	endpoint string
+	platform string
+	selfID   string
+	sn       int64
+	cancel   context.CancelFunc
+
+	// Satori addresses messages and DMs by channel, OneBot by message and user ID
+	messageChannels *lru.Cache[string, string]
+	userChannels    *lru.Cache[string, string]
+	channelUsers    *lru.Cache[string, string]
+}
+
+var _ onebot.API = (*Client)(nil)
+
+func NewClient(log zerolog.Logger, id, token string, timeout time.Duration) *Client {
+	messageChannels, _ := lru.New[string, string](8192)
+	userChannels, _ := lru.New[string, string](1024)
+	channelUsers, _ := lru.New[string, string](1024)
+
+	return &Client{
+		log:             log.With().Str("client", id).Str("protocol", "satori").Logger(),
+		id:              id,
+		token:           token,
+		httpClient:      &http.Client{Timeout: timeout},
+		messageChannels: messageChannels,
+		userChannels:    userChannels,
+		channelUsers:    channelUsers,
+	}
+}
+
+// Start connects to the event stream of the Satori server at endpoint, the transport mode doesn't apply
+func (c *Client) Start(mode onebot.TransportMode, endpoint string) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c.lock.Lock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.endpoint = strings.TrimSuffix(endpoint, "/")
+	c.cancel = cancel
+	c.lock.Unlock()
+
+	go c.connectLoop(ctx)
+}
+
+func (c *Client) Release() {
+	c.lock.Lock()
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	c.lock.Unlock()
+
+	c.isLoggedIn.Store(false)
+}
+
+func (c *Client) SetEventHandler(handler func(onebot.IEvent)) {
+	c.eventHandler = handler
+}
+
+func (c *Client) SetStatusHandler(handler func(onebot.ClientStatus)) {
+	c.statusHandler = handler
+}
+
+func (c *Client) GetStatus() onebot.ClientStatus {
+	return onebot.ClientStatus(c.lastStatus.Load())
+}
+
+// setStatus calls the handler synchronously under statusLock, so that changes are delivered in order
+func (c *Client) setStatus(status onebot.ClientStatus) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	if onebot.ClientStatus(c.lastStatus.Swap(int32(status))) == status {
+		return
+	}
+
+	c.log.Debug().Stringer("status", status).Msg("Client status changed")
+	if c.statusHandler != nil {
+		c.statusHandler(status)
+	}
+}
+
+func (c *Client) IsLoggedIn() bool {
+	return c.isLoggedIn.Load()
+}
+
+// IsReconnecting reports a known login whose event stream is down, requests still go through the HTTP API meanwhile
+func (c *Client) IsReconnecting() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cancel != nil && c.selfID != "" && !c.isLoggedIn.Load()
+}
+
+func (c *Client) GetToken() string {
+	return c.token
+}
+
+func (c *Client) GetAgentType() onebot.AgentType {
+	return onebot.AgentSatori
+}
+
+func (c *Client) GetProfile() onebot.AgentProfile {
+	return onebot.ProfileFor(onebot.AgentSatori)
+}
+
+// GetAgentInfo reports the platform of the login, Satori has no capability queries
+func (c *Client) GetAgentInfo() onebot.AgentInfo {
+	platform, _ := c.getSelf()
+	return onebot.AgentInfo{
+		AppName:       platform,
+		CanSendImage:  true,
+		CanSendRecord: true,
+	}
+}
+
+func (c *Client) connectLoop(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		if err := c.connect(ctx); err != nil {
+			c.log.Warn().Err(err).Dur("backoff", backoff).Msg("Satori event stream failed")
+		} else {
+			backoff = minBackoff
+		}
+		c.isLoggedIn.Store(false)
+		c.setStatus(onebot.StatusDisconnected)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	c.lock.Lock()
+	endpoint, sn := c.endpoint, c.sn
+	c.lock.Unlock()
+
+	eventsURL := strings.Replace(endpoint, "http", "ws", 1) + "/v1/events"
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, eventsURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Unblock the reader when the client is released
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	var writeLock sync.Mutex
+	write := func(op Opcode, body any) error {
+		signal := Signal{Op: op}
+		if body != nil {
+			data, err := json.Marshal(body)
+			if err != nil {
+				return err
+			}
+			signal.Body = data
+		}
+
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		return conn.WriteJSON(signal)
+	}
+
+	if err := write(OpIdentify, &Identify{Token: c.token, SN: sn}); err != nil {
+		return err
+	}
+
+	pingCtx, cancelPing := context.WithCancel(ctx)
+	defer cancelPing()
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pingCtx.Done():
+				return
+			case <-ticker.C:
+				if err := write(OpPing, nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var signal Signal
+		if err := conn.ReadJSON(&signal); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		c.log.Trace().Msgf("Receive Satori signal: %d %s", signal.Op, signal.Body)
+
+		switch signal.Op {
+		case OpReady:
+			var ready Ready
+			if err := json.Unmarshal(signal.Body, &ready); err != nil {
+				return fmt.Errorf("failed to unmarshal ready: %w", err)
+			}
+			c.handleReady(&ready)
+		case OpEvent:
+			var event Event
+			if err := json.Unmarshal(signal.Body, &event); err != nil {
+				c.log.Warn().Err(err).Msg("Failed to unmarshal event")
+				continue
+			}
+			c.handleEvent(&event)
+		}
+	}
+}
+
+func (c *Client) handleReady(ready *Ready) {
+	for _, login := range ready.Logins {
+		// Without a login ID (while logging in) the first login is used
+		if c.id != "" && login.ID() != c.id {
+			continue
+		}
+
+		c.lock.Lock()
+		c.platform = login.Platform
+		c.selfID = login.ID()
+		c.lock.Unlock()
+
+		c.log.Info().Str("platform", login.Platform).Str("self_id", login.ID()).Msg("Satori login ready")
+		c.applyLoginStatus(login.Status)
+		return
+	}
+
+	c.log.Warn().Msg("No matching login in Satori ready signal")
+	c.isLoggedIn.Store(false)
+	c.setStatus(onebot.StatusOffline)
+}
+
+func (c *Client) applyLoginStatus(status LoginStatus) {
+	switch status {
+	case LoginOnline:
+		c.isLoggedIn.Store(true)
+		c.setStatus(onebot.StatusConnected)
+	case LoginConnect, LoginReconnect:
+		c.isLoggedIn.Store(false)
+		c.setStatus(onebot.StatusUnhealthy)
+	default:
+		c.isLoggedIn.Store(false)
+		c.setStatus(onebot.StatusOffline)
+	}
+}
+
+func (c *Client) getSelf() (string, string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.platform, c.selfID
+}
+
+// call invokes a method of the Satori HTTP API
+func (c *Client) call(method string, params any, result any) error {
+	c.lock.Lock()
+	endpoint, platform, selfID := c.endpoint, c.platform, c.selfID
+	c.lock.Unlock()
+
+	if endpoint == "" {
+		return errors.New("Satori未连接")
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/v1/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	// Satori 1.2 renamed the headers, send both
+	req.Header.Set("Satori-Platform", platform)
+	req.Header.Set("Satori-User-ID", selfID)
+	req.Header.Set("X-Platform", platform)
+	req.Header.Set("X-Self-ID", selfID)
+
+	c.log.Trace().Str("method", method).Msgf("Send Satori request %s", body)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Satori错误 %d: %s", resp.StatusCode, data)
+	}
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,162 @@
+package satori
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/duo/matrix-pylon/pkg/onebot"
+)
+
+var contentEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+// encodeContent renders OneBot segments as Satori message elements
+func encodeContent(segments []onebot.ISegment) string {
+	var sb strings.Builder
+
+	for _, seg := range segments {
+		data := segmentData(seg)
+		switch seg.SegmentType() {
+		case onebot.Text:
+			sb.WriteString(contentEscaper.Replace(fmt.Sprint(data["text"])))
+		case onebot.At:
+			if data["qq"] == "all" {
+				sb.WriteString(`<at type="all"/>`)
+			} else {
+				fmt.Fprintf(&sb, `<at id="%s"/>`, contentEscaper.Replace(fmt.Sprint(data["qq"])))
+			}
+		case onebot.Face:
+			fmt.Fprintf(&sb, `<face id="%s"/>`, contentEscaper.Replace(fmt.Sprint(data["id"])))
+		case onebot.Reply:
+			fmt.Fprintf(&sb, `<quote id="%s"/>`, contentEscaper.Replace(fmt.Sprint(data["id"])))
+		case onebot.Image:
+			fmt.Fprintf(&sb, `<img src="%s"/>`, contentEscaper.Replace(fmt.Sprint(data["file"])))
+		case onebot.Record:
+			fmt.Fprintf(&sb, `<audio src="%s"/>`, contentEscaper.Replace(fmt.Sprint(data["file"])))
+		case onebot.Video:
+			fmt.Fprintf(&sb, `<video src="%s"/>`, contentEscaper.Replace(fmt.Sprint(data["file"])))
+		case onebot.File:
+			fmt.Fprintf(&sb, `<file src="%s" title="%s"/>`,
+				contentEscaper.Replace(fmt.Sprint(data["file"])), contentEscaper.Replace(fmt.Sprint(data["name"])))
+		case onebot.Location:
+			sb.WriteString(contentEscaper.Replace(fmt.Sprintf("[%v] %v (%v, %v)", data["title"], data["content"], data["lat"], data["lon"])))
+		}
+	}
+
+	return sb.String()
+}
+
+func segmentData(seg onebot.ISegment) map[string]interface{} {
+	switch v := seg.(type) {
+	case *onebot.TextSegment:
+		return v.Data
+	case *onebot.AtSegment:
+		return v.Data
+	case *onebot.FaceSegment:
+		return v.Data
+	case *onebot.ReplySegment:
+		return v.Data
+	case *onebot.ImageSegment:
+		return v.Data
+	case *onebot.RecordSegment:
+		return v.Data
+	case *onebot.VideoSegment:
+		return v.Data
+	case *onebot.FileSegment:
+		return v.Data
+	case *onebot.LocationSegment:
+		return v.Data
+	}
+	return map[string]interface{}{}
+}
+
+// decodeContent parses Satori message elements into OneBot 11 segment objects,
+// formatting elements are flattened to their text
+func decodeContent(content string) []interface{} {
+	d := xml.NewDecoder(strings.NewReader("<root>" + content + "</root>"))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	var segments []interface{}
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			segments = append(segments, newSegment(onebot.Text, map[string]interface{}{"text": text.String()}))
+			text.Reset()
+		}
+	}
+	add := func(segType onebot.SegmentType, data map[string]interface{}) {
+		flush()
+		segments = append(segments, newSegment(segType, data))
+	}
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				// Keep what could be parsed, the rest is most likely plain text
+				offset := int(d.InputOffset()) - len("<root>")
+				text.WriteString(content[min(max(offset, 0), len(content)):])
+			}
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			attrs := make(map[string]string, len(t.Attr))
+			for _, attr := range t.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+
+			switch t.Name.Local {
+			case "at":
+				if attrs["type"] == "all" {
+					add(onebot.At, map[string]interface{}{"qq": "all"})
+				} else {
+					add(onebot.At, map[string]interface{}{"qq": attrs["id"], "name": attrs["name"]})
+				}
+				d.Skip()
+			case "img", "image":
+				add(onebot.Image, map[string]interface{}{"file": attrs["src"], "url": attrs["src"]})
+				d.Skip()
+			case "audio":
+				add(onebot.Record, map[string]interface{}{"file": attrs["src"], "url": attrs["src"]})
+				d.Skip()
+			case "video":
+				add(onebot.Video, map[string]interface{}{"file": attrs["src"], "url": attrs["src"]})
+				d.Skip()
+			case "file":
+				add(onebot.File, map[string]interface{}{"file": attrs["src"], "url": attrs["src"], "name": attrs["title"]})
+				d.Skip()
+			case "face":
+				add(onebot.Face, map[string]interface{}{"id": attrs["id"]})
+				d.Skip()
+			case "quote":
+				// The quoted content is looked up by ID
+				add(onebot.Reply, map[string]interface{}{"id": attrs["id"]})
+				d.Skip()
+			case "br":
+				text.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p", "message":
+				if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+					text.WriteString("\n")
+				}
+			}
+		}
+	}
+	flush()
+
+	return segments
+}
+
+func newSegment(segType onebot.SegmentType, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": string(segType), "data": data}
+}
@@ -0,0 +1,201 @@
+package satori
+
+import (
+	"cmp"
+	"strings"
+
+	"github.com/duo/matrix-pylon/pkg/onebot"
+)
+
+func (c *Client) handleEvent(e *Event) {
+	c.lock.Lock()
+	if sn := e.Serial(); sn > c.sn {
+		c.sn = sn
+	}
+	selfID := c.selfID
+	c.lock.Unlock()
+
+	// A Satori server can host several logins
+	if loginID := e.LoginID(); selfID != "" && loginID != "" && loginID != selfID {
+		return
+	}
+
+	switch e.Type {
+	case EventLoginAdded, EventLoginUpdated:
+		if e.Login != nil {
+			c.applyLoginStatus(e.Login.Status)
+		}
+		return
+	case EventLoginRemoved:
+		c.applyLoginStatus(LoginOffline)
+		return
+	}
+
+	m := c.translateEvent(e, selfID)
+	if m == nil {
+		c.log.Debug().Str("type", e.Type).Msg("Ignoring Satori event")
+		return
+	}
+
+	payload, err := onebot.UnmarshalPayload(m)
+	if err != nil {
+		c.log.Warn().Err(err).Str("type", e.Type).Msg("Failed to translate Satori event")
+		return
+	}
+
+	if c.eventHandler != nil {
+		go c.eventHandler(payload.(onebot.IEvent))
+	}
+}
+
+// translateEvent turns a Satori event into the OneBot 11 event object it corresponds to.
+// Group chats are Satori channels, their guild is assumed to share the ID as with the QQ adapters.
+func (c *Client) translateEvent(e *Event, selfID string) map[string]interface{} {
+	m := map[string]interface{}{
+		"time":    e.Timestamp / 1000,
+		"self_id": selfID,
+	}
+
+	userID := ""
+	if e.User != nil {
+		userID = e.User.ID
+	}
+	operatorID := ""
+	if e.Operator != nil {
+		operatorID = e.Operator.ID
+	}
+	guildID := ""
+	if e.Guild != nil {
+		guildID = e.Guild.ID
+	} else if e.Channel != nil {
+		guildID = e.Channel.ID
+	}
+
+	switch e.Type {
+	case EventMessageCreated:
+		if e.Message == nil {
+			return nil
+		}
+		return c.messageToOnebot(e.Message, e, selfID)
+	case EventMessageDeleted:
+		if e.Message == nil || e.Channel == nil {
+			return nil
+		}
+		m["post_type"] = "notice"
+		m["message_id"] = e.Message.ID
+		m["user_id"] = userID
+		if e.Channel.Type == ChannelDirect {
+			m["notice_type"] = "friend_recall"
+		} else {
+			m["notice_type"] = "group_recall"
+			m["group_id"] = e.Channel.ID
+			m["operator_id"] = cmp.Or(operatorID, userID)
+		}
+	case EventGuildMemberAdded:
+		m["post_type"] = "notice"
+		m["notice_type"] = "group_increase"
+		m["sub_type"] = "approve"
+		m["group_id"] = guildID
+		m["user_id"] = userID
+		m["operator_id"] = operatorID
+	case EventGuildMemberRemoved:
+		m["post_type"] = "notice"
+		m["notice_type"] = "group_decrease"
+		m["group_id"] = guildID
+		m["user_id"] = userID
+		m["operator_id"] = operatorID
+		if userID == selfID {
+			m["sub_type"] = "kick_me"
+		} else if operatorID != "" && operatorID != userID {
+			m["sub_type"] = "kick"
+		} else {
+			m["sub_type"] = "leave"
+		}
+	case EventFriendRequest, EventGuildMemberRequest, EventGuildRequest:
+		if e.Message == nil {
+			return nil
+		}
+		// Requests are answered with the ID of the message that carries them
+		m["post_type"] = "request"
+		m["flag"] = e.Message.ID
+		m["comment"] = e.Message.Content
+		m["user_id"] = userID
+		switch e.Type {
+		case EventFriendRequest:
+			m["request_type"] = "friend"
+		case EventGuildMemberRequest:
+			m["request_type"] = "group"
+			m["sub_type"] = "add"
+			m["group_id"] = guildID
+		case EventGuildRequest:
+			m["request_type"] = "group"
+			m["sub_type"] = "invite"
+			m["group_id"] = guildID
+		}
+	default:
+		return nil
+	}
+
+	return m
+}
+
+// messageToOnebot converts a message, with the channel and sender taken from the event if the message lacks them
+func (c *Client) messageToOnebot(msg *Message, e *Event, selfID string) map[string]interface{} {
+	channel, user, member := msg.Channel, msg.User, msg.Member
+	timestamp := msg.CreatedAt
+	if e != nil {
+		channel = cmp.Or(channel, e.Channel)
+		user = cmp.Or(user, e.User)
+		member = cmp.Or(member, e.Member)
+		timestamp = cmp.Or(timestamp, e.Timestamp)
+	}
+	if channel == nil {
+		return nil
+	}
+	c.messageChannels.Add(msg.ID, channel.ID)
+
+	sender := map[string]interface{}{}
+	userID := ""
+	if user != nil {
+		userID = user.ID
+		sender["user_id"] = user.ID
+		sender["nickname"] = cmp.Or(user.Name, user.Nick)
+	}
+	if member != nil {
+		sender["card"] = member.Nick
+	}
+
+	m := map[string]interface{}{
+		"time":       timestamp / 1000,
+		"self_id":    selfID,
+		"post_type":  "message",
+		"message_id": msg.ID,
+		"user_id":    userID,
+		"sender":     sender,
+		"message":    decodeContent(msg.Content),
+	}
+	if userID == selfID {
+		m["post_type"] = "message_sent"
+	}
+
+	if channel.Type == ChannelDirect {
+		m["message_type"] = "private"
+		if userID != selfID {
+			c.rememberDirectChannel(userID, channel.ID)
+		} else if target, ok := c.channelUsers.Get(channel.ID); ok {
+			m["target_id"] = target
+		} else {
+			m["target_id"] = strings.TrimPrefix(channel.ID, "private:")
+		}
+	} else {
+		m["message_type"] = "group"
+		m["group_id"] = channel.ID
+	}
+
+	return m
+}
+
+func (c *Client) rememberDirectChannel(userID, channelID string) {
+	c.userChannels.Add(userID, channelID)
+	c.channelUsers.Add(channelID, userID)
+}
@@ -0,0 +1,156 @@
+package satori
+
+import "encoding/json"
+
+type Opcode int
+
+const (
+	OpEvent    Opcode = 0
+	OpPing     Opcode = 1
+	OpPong     Opcode = 2
+	OpIdentify Opcode = 3
+	OpReady    Opcode = 4
+)
+
+type Signal struct {
+	Op   Opcode          `json:"op"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+type Identify struct {
+	Token string `json:"token,omitempty"`
+	SN    int64  `json:"sn,omitempty"`
+}
+
+type Ready struct {
+	Logins []*Login `json:"logins"`
+}
+
+type ChannelType int
+
+const (
+	ChannelText     ChannelType = 0
+	ChannelDirect   ChannelType = 1
+	ChannelCategory ChannelType = 2
+	ChannelVoice    ChannelType = 3
+)
+
+type LoginStatus int
+
+const (
+	LoginOffline    LoginStatus = 0
+	LoginOnline     LoginStatus = 1
+	LoginConnect    LoginStatus = 2
+	LoginDisconnect LoginStatus = 3
+	LoginReconnect  LoginStatus = 4
+)
+
+type User struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Nick   string `json:"nick,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+	IsBot  bool   `json:"is_bot,omitempty"`
+}
+
+type Guild struct {
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+type Channel struct {
+	ID       string      `json:"id"`
+	Type     ChannelType `json:"type"`
+	Name     string      `json:"name,omitempty"`
+	ParentID string      `json:"parent_id,omitempty"`
+}
+
+type GuildMember struct {
+	User     *User  `json:"user,omitempty"`
+	Nick     string `json:"nick,omitempty"`
+	Avatar   string `json:"avatar,omitempty"`
+	JoinedAt int64  `json:"joined_at,omitempty"`
+}
+
+type Login struct {
+	User     *User       `json:"user,omitempty"`
+	SelfID   string      `json:"self_id,omitempty"`
+	Platform string      `json:"platform,omitempty"`
+	Status   LoginStatus `json:"status"`
+}
+
+// ID returns the user ID of the login, which moved from self_id to user.id in Satori 1.2
+func (l *Login) ID() string {
+	if l.User != nil && l.User.ID != "" {
+		return l.User.ID
+	}
+	return l.SelfID
+}
+
+type Message struct {
+	ID        string       `json:"id"`
+	Content   string       `json:"content"`
+	Channel   *Channel     `json:"channel,omitempty"`
+	Guild     *Guild       `json:"guild,omitempty"`
+	Member    *GuildMember `json:"member,omitempty"`
+	User      *User        `json:"user,omitempty"`
+	CreatedAt int64        `json:"created_at,omitempty"`
+}
+
+type Event struct {
+	SN        int64        `json:"sn,omitempty"`
+	ID        int64        `json:"id,omitempty"`
+	Type      string       `json:"type"`
+	Platform  string       `json:"platform,omitempty"`
+	SelfID    string       `json:"self_id,omitempty"`
+	Timestamp int64        `json:"timestamp"`
+	Channel   *Channel     `json:"channel,omitempty"`
+	Guild     *Guild       `json:"guild,omitempty"`
+	Login     *Login       `json:"login,omitempty"`
+	Member    *GuildMember `json:"member,omitempty"`
+	Message   *Message     `json:"message,omitempty"`
+	Operator  *User        `json:"operator,omitempty"`
+	User      *User        `json:"user,omitempty"`
+}
+
+// Serial returns the sequence number used to resume the event stream
+func (e *Event) Serial() int64 {
+	if e.SN != 0 {
+		return e.SN
+	}
+	return e.ID
+}
+
+func (e *Event) LoginID() string {
+	if e.Login != nil {
+		if id := e.Login.ID(); id != "" {
+			return id
+		}
+	}
+	return e.SelfID
+}
+
+type List[T any] struct {
+	Data []T    `json:"data"`
+	Next string `json:"next,omitempty"`
+}
+
+type BidiList[T any] struct {
+	Data []T    `json:"data"`
+	Prev string `json:"prev,omitempty"`
+	Next string `json:"next,omitempty"`
+}
+
+const (
+	EventMessageCreated     = "message-created"
+	EventMessageDeleted     = "message-deleted"
+	EventGuildMemberAdded   = "guild-member-added"
+	EventGuildMemberRemoved = "guild-member-removed"
+	EventGuildMemberRequest = "guild-member-request"
+	EventGuildRequest       = "guild-request"
+	EventFriendRequest      = "friend-request"
+	EventLoginAdded         = "login-added"
+	EventLoginRemoved       = "login-removed"
+	EventLoginUpdated       = "login-updated"
+)